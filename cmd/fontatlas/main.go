@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+
+	"github.com/perlw/sandbox_go/pkg/fontloader"
+)
+
+// parseRune accepts decimal, 0x prefixed hex and U+ notation
+func parseRune(s string) (rune, error) {
+	s = strings.TrimSpace(s)
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+	case strings.HasPrefix(s, "U+"), strings.HasPrefix(s, "u+"):
+		s, base = s[2:], 16
+	}
+	r, err := strconv.ParseInt(s, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rune \"%s\": %w", s, err)
+	}
+	return rune(r), nil
+}
+
+// parseRanges parses a comma separated list of runes and inclusive rune
+// ranges, e.g. "32-126,0x20AC"
+func parseRanges(s string) ([]fontloader.RuneRange, error) {
+	var ranges []fontloader.RuneRange
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := parseRune(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseRune(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		ranges = append(ranges, fontloader.RuneRange{First: first, Last: last})
+	}
+	return ranges, nil
+}
+
+// parseSize parses WxH, an empty string being 0x0
+func parseSize(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(s, "x", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid size \"%s\", expected WxH", s)
+	}
+	w, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid size \"%s\": %w", s, err)
+	}
+	h, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid size \"%s\": %w", s, err)
+	}
+	return w, h, nil
+}
+
+// parseColor parses #rgb, #rrggbb and #rrggbbaa
+func parseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color \"%s\", expected #rrggbb or #rrggbbaa", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// parseEffectArgs splits comma separated numbers followed by colors
+func parseEffectArgs(s string, numbers, colors int) ([]float64, []color.NRGBA, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != numbers+colors {
+		return nil, nil, fmt.Errorf("invalid effect \"%s\", expected %d numbers and %d colors", s, numbers, colors)
+	}
+	nums := make([]float64, numbers)
+	for i := range nums {
+		v, err := strconv.ParseFloat(strings.TrimSpace(parts[i]), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid effect \"%s\": %w", s, err)
+		}
+		nums[i] = v
+	}
+	cols := make([]color.NRGBA, colors)
+	for i := range cols {
+		c, err := parseColor(parts[numbers+i])
+		if err != nil {
+			return nil, nil, err
+		}
+		cols[i] = c
+	}
+	return nums, cols, nil
+}
+
+// readStrings returns the text of a file, or every string in it if it is a
+// json string table
+func readStrings(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Ext(path) != ".json" {
+		return string(data), nil
+	}
+	var table interface{}
+	if err := json.Unmarshal(data, &table); err != nil {
+		return "", fmt.Errorf("could not parse \"%s\": %w", path, err)
+	}
+	var text strings.Builder
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			text.WriteString(v)
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(table)
+	return text.String(), nil
+}
+
+// printCoverage lists the blocks the font covers and the runes it has
+// glyphs for, in the format -ranges takes
+func printCoverage(c fontloader.Coverage) {
+	fmt.Printf("glyphs %d, runes %d\n", c.Glyphs, c.Runes)
+	for _, b := range c.Blocks {
+		fmt.Printf("  U+%04X-U+%04X %-40s %5d/%-5d %5.1f%%\n", b.First, b.Last, b.Name, b.Covered, b.Total, 100*float64(b.Covered)/float64(b.Total))
+	}
+	ranges := make([]string, len(c.Ranges))
+	for i, r := range c.Ranges {
+		ranges[i] = fmt.Sprintf("U+%04X-U+%04X", r.First, r.Last)
+		if r.First == r.Last {
+			ranges[i] = fmt.Sprintf("U+%04X", r.First)
+		}
+	}
+	fmt.Printf("ranges %s\n", strings.Join(ranges, ","))
+}
+
+var lcdFilters = map[string][]float64{
+	"default": fontloader.LCDFilterDefault,
+	"light":   fontloader.LCDFilterLight,
+	"none":    fontloader.LCDFilterNone,
+}
+
+// parseLCDFilter takes a named filter or comma separated weights
+func parseLCDFilter(s string) ([]float64, error) {
+	if filter, ok := lcdFilters[s]; ok {
+		return filter, nil
+	}
+	var filter []float64
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lcd filter \"%s\": %w", s, err)
+		}
+		filter = append(filter, v)
+	}
+	return filter, nil
+}
+
+var hintings = map[string]font.Hinting{
+	"none":     font.HintingNone,
+	"vertical": font.HintingVertical,
+	"full":     font.HintingFull,
+}
+
+func main() {
+	var fontFile, outFile, metricsFile, rangeList, mode, hinting, cell, atlas, maxAtlas, fallbacks, bmfont, check, lcdFilter string
+	var coverage bool
+	var opts fontloader.LoadOptions
+	var face int
+	flag.StringVar(&fontFile, "font", "", "the ttf, otf or ttc to build the atlas from")
+	flag.IntVar(&face, "face", 0, "the face to use from a font collection")
+	flag.StringVar(&fallbacks, "fallback", "", "comma separated fonts to take runes missing in the font from, in order")
+	flag.StringVar(&outFile, "out", "", "the png to output the atlas to, extra pages get a _N suffix and the metrics a .json extension")
+	flag.StringVar(&metricsFile, "metrics", "", "also write the glyph metrics, without page checksums, to this json")
+	flag.StringVar(&bmfont, "bmfont", "", "also write a BMFont .fnt next to out (text, xml, binary)")
+	flag.Float64Var(&opts.Size, "size", 16, "the font size in points")
+	flag.Float64Var(&opts.DPI, "dpi", 72, "the resolution, at 72 points and pixels are the same")
+	flag.StringVar(&hinting, "hinting", "none", "the hinting mode (none, vertical, full)")
+	flag.StringVar(&cell, "cell", "", "fixed cell size as WxH, sized from the font if empty")
+	flag.StringVar(&atlas, "atlas", "", "fixed page size as WxH, grown to fit if empty")
+	flag.StringVar(&maxAtlas, "max-atlas", "4096x4096", "the size pages may grow to before another page is started")
+	flag.StringVar(&rangeList, "ranges", "32-255", "comma separated runes and rune ranges, e.g. 32-126,0x20AC")
+	flag.StringVar(&opts.Text, "text", "", "sample text whose runes are added to the ranges")
+	flag.IntVar(&opts.Padding, "padding", 0, "padding around each glyph, also the spread in sdf modes")
+	flag.IntVar(&opts.SDFOversample, "sdf-oversample", 8, "how many times larger glyphs are rendered before conversion in sdf mode")
+	flag.IntVar(&opts.Gutter, "gutter", 1, "empty space between glyphs in the atlas")
+	flag.IntVar(&opts.MipLevels, "mip-levels", 0, "align glyphs for this many mip levels, raising the gutter to match")
+	flag.IntVar(&opts.Workers, "workers", 0, "how many glyphs to render at once, 0 for one per cpu")
+	flag.Func("outline", "add an outline effect as width,#color", func(s string) error {
+		n, c, err := parseEffectArgs(s, 1, 1)
+		if err == nil {
+			opts.Effects = append(opts.Effects, fontloader.Outline{Width: n[0], Color: c[0]})
+		}
+		return err
+	})
+	flag.Func("shadow", "add a drop shadow effect as x,y,blur,#color", func(s string) error {
+		n, c, err := parseEffectArgs(s, 3, 1)
+		if err == nil {
+			opts.Effects = append(opts.Effects, fontloader.DropShadow{OffsetX: int(n[0]), OffsetY: int(n[1]), Blur: n[2], Color: c[0]})
+		}
+		return err
+	})
+	flag.Func("glow", "add an inner glow effect as radius,#color", func(s string) error {
+		n, c, err := parseEffectArgs(s, 1, 1)
+		if err == nil {
+			opts.Effects = append(opts.Effects, fontloader.InnerGlow{Radius: n[0], Color: c[0]})
+		}
+		return err
+	})
+	flag.Func("gradient", "add a gradient fill effect as #top,#bottom", func(s string) error {
+		_, c, err := parseEffectArgs(s, 0, 2)
+		if err == nil {
+			opts.Effects = append(opts.Effects, fontloader.Gradient{Top: c[0], Bottom: c[1]})
+		}
+		return err
+	})
+	flag.StringVar(&mode, "mode", string(fontloader.ModeBitmap), "the atlas mode (bitmap, sdf, msdf, lcd)")
+	flag.StringVar(&lcdFilter, "lcd-filter", "default", "the subpixel filter in lcd mode (default, light, none) or comma separated weights")
+	flag.BoolVar(&coverage, "coverage", false, "list the unicode blocks and runes the font covers")
+	flag.StringVar(&check, "check", "", "list the runes of a text file, or the strings of a json string table, the font is missing")
+	flag.Parse()
+
+	report := coverage || check != ""
+	if fontFile == "" || (outFile == "" && !report) {
+		flag.PrintDefaults()
+		os.Exit(-1)
+	}
+	if outFile != "" && filepath.Ext(outFile) != ".png" {
+		fmt.Println("out file should be png")
+		os.Exit(-1)
+	}
+	ranges, err := parseRanges(rangeList)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	opts.Ranges = ranges
+	if opts.CellWidth, opts.CellHeight, err = parseSize(cell); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	if opts.AtlasWidth, opts.AtlasHeight, err = parseSize(atlas); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	if opts.MaxAtlasWidth, opts.MaxAtlasHeight, err = parseSize(maxAtlas); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	var ok bool
+	if opts.Hinting, ok = hintings[hinting]; !ok {
+		fmt.Printf("unknown hinting \"%s\"\n", hinting)
+		os.Exit(-1)
+	}
+	opts.Mode = fontloader.Mode(mode)
+	if opts.Mode == fontloader.ModeLCD {
+		if opts.LCDFilter, err = parseLCDFilter(lcdFilter); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	data, err := ioutil.ReadFile(fontFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	f, err := fontloader.ParseFontIndex(data, face)
+	if err != nil {
+		fmt.Printf("font \"%s\": %s\n", fontFile, err.Error())
+		os.Exit(-1)
+	}
+	if fallbacks != "" {
+		var chain []*fontloader.Font
+		for _, path := range strings.Split(fallbacks, ",") {
+			fb, err := fontloader.LoadFont(path)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(-1)
+			}
+			chain = append(chain, fb)
+		}
+		f = f.WithFallback(chain...)
+	}
+
+	if report {
+		if coverage {
+			printCoverage(f.Coverage())
+		}
+		var missing []rune
+		if check != "" {
+			text, err := readStrings(check)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(-1)
+			}
+			missing = f.Missing(text)
+			for _, r := range missing {
+				fmt.Printf("missing U+%04X %q\n", r, r)
+			}
+		}
+		if len(missing) > 0 {
+			os.Exit(-1)
+		}
+		if outFile == "" {
+			return
+		}
+	}
+	charset, err := f.Charset(opts)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+
+	for _, r := range charset.Missing {
+		fmt.Printf("missing U+%04X %q\n", r, r)
+	}
+
+	if err := charset.Save(outFile); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+
+	if metricsFile != "" {
+		if err := charset.SaveMetrics(metricsFile); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(-1)
+		}
+	}
+
+	if bmfont != "" {
+		fntFile := strings.TrimSuffix(outFile, filepath.Ext(outFile)) + ".fnt"
+		if err := charset.SaveBMFont(fntFile, fontloader.BMFontFormat(bmfont)); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(-1)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestReadStrings(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"strings.txt":  `{"menu": "ab"}`,
+		"strings.json": `{"menu": {"start": "ab", "quit": ["cd", 1, {"x": "ef"}]}, "title": "g"}`,
+	}
+	want := map[string]string{
+		"strings.txt":  `{"menu": "ab"}`,
+		"strings.json": "abcdefg",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		text, err := readStrings(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Map order is random, only the runes matter
+		runes := []rune(text)
+		sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+		sorted := []rune(want[name])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		if string(runes) != string(sorted) {
+			t.Fatalf("%s read as %q, want the runes of %q", name, text, want[name])
+		}
+	}
+
+	broken := filepath.Join(dir, "broken.json")
+	if err := ioutil.WriteFile(broken, []byte(`{"menu": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readStrings(broken); err == nil {
+		t.Fatal("broken string table read")
+	}
+	if _, err := readStrings(filepath.Join(dir, "none.txt")); err == nil {
+		t.Fatal("missing file read")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+func inspect(args []string) error {
+	var jsonOut bool
+	var bins int
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	flags.BoolVar(&jsonOut, "json", false, "output the report as json")
+	flags.IntVar(&bins, "bins", 16, "number of histogram bins (1-256)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: sdf inspect [flags] file.png...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(-1)
+	}
+
+	type report struct {
+		File string `json:"file"`
+		sdf.Info
+	}
+	var reports []report
+	for _, inFile := range flags.Args() {
+		img, err := loadPNG(inFile)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report{
+			File: inFile,
+			Info: sdf.Inspect(img, bins),
+		})
+	}
+
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if len(reports) == 1 {
+			return enc.Encode(reports[0])
+		}
+		return enc.Encode(reports)
+	}
+
+	for _, r := range reports {
+		total := r.Width * r.Height
+		fmt.Printf("file:     %s\n", r.File)
+		fmt.Printf("size:     %dx%d\n", r.Width, r.Height)
+		fmt.Printf("encoding: %s\n", r.Encoding)
+		fmt.Printf("min/max:  %d/%d\n", r.Min, r.Max)
+		fmt.Printf("spread:   %.2fpx\n", r.Spread)
+		fmt.Printf("inside:   %d (%.1f%%)\n", r.Inside, percent(r.Inside, total))
+		fmt.Printf("outside:  %d (%.1f%%)\n", r.Outside, percent(r.Outside, total))
+		fmt.Println("histogram:")
+
+		var peak int
+		for _, n := range r.Histogram {
+			if n > peak {
+				peak = n
+			}
+		}
+		bins := len(r.Histogram)
+		for i, n := range r.Histogram {
+			var bar int
+			if peak > 0 {
+				bar = n * 40 / peak
+			}
+			lo := (i*256 + bins - 1) / bins
+			hi := ((i+1)*256+bins-1)/bins - 1
+			fmt.Printf("  %3d-%3d %-40s %d\n", lo, hi, strings.Repeat("#", bar), n)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
@@ -4,8 +4,9 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"path/filepath"
+	"time"
 
 	"image"
 	"image/png"
@@ -46,35 +47,73 @@ func savePNG(img image.Image, filepath string) error {
 }
 
 func main() {
+	var cmd string
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	var err error
+	switch cmd {
+	case "inspect":
+		err = inspect(os.Args[2:])
+	case "preview":
+		err = preview(os.Args[2:])
+	case "build":
+		err = build(os.Args[2:])
+	default:
+		err = generate()
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+}
+
+func generate() error {
 	var inFile, outFile string
-	flag.StringVar(&inFile, "in", "", "the png to calculate the sdf for")
-	flag.StringVar(&outFile, "out", "", "the png to output sdf to")
+	var watchMode bool
+	var interval time.Duration
+	var opts sdf.Options
+	var threshold uint
+	var channel, algorithm string
+	flag.StringVar(&inFile, "in", "", "the png, or directory of pngs, to calculate the sdf for")
+	flag.StringVar(&outFile, "out", "", "the png, or directory, to output sdf to")
+	flag.BoolVar(&watchMode, "watch", false, "poll the input for changes and rebuild outputs")
+	flag.DurationVar(&interval, "interval", 500*time.Millisecond, "the poll interval in watch mode")
+	flag.Float64Var(&opts.Spread, "spread", sdf.DefaultSpread, "the distance in pixels from the edge to a saturated value")
+	flag.UintVar(&threshold, "threshold", 0, "the channel value (0-255) above which a pixel is inside")
+	flag.StringVar(&channel, "channel", string(sdf.ChannelRed), "the channel to threshold (r, g, b, a, luma)")
+	flag.IntVar(&opts.Scale, "scale", 1, "the factor to downsample the output by")
+	flag.StringVar(&algorithm, "algorithm", string(sdf.Algorithm8SSEDT), "the distance algorithm (8ssedt, brute)")
 	flag.Parse()
 
 	if inFile == "" || outFile == "" {
 		flag.PrintDefaults()
 		os.Exit(-1)
 	}
-
-	if filepath.Ext(inFile) != ".png" || filepath.Ext(outFile) != ".png" {
-		fmt.Println("in/out file should be png")
-		os.Exit(-1)
+	if threshold > 255 {
+		return fmt.Errorf("threshold should be 0-255")
 	}
+	opts.Threshold = uint8(threshold)
+	opts.Channel = sdf.Channel(channel)
+	opts.Algorithm = sdf.Algorithm(algorithm)
 
-	srcPNG, err := loadPNG(inFile)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(-1)
+	if watchMode {
+		return watch(inFile, outFile, opts, interval)
 	}
 
-	outPNG, err := sdf.Generate(srcPNG)
+	jobs, err := listJobs(inFile, outFile, opts)
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(-1)
+		return err
 	}
-
-	if err := savePNG(outPNG, outFile); err != nil {
-		fmt.Println(err.Error())
-		os.Exit(-1)
+	for _, j := range jobs {
+		data, err := ioutil.ReadFile(j.in)
+		if err != nil {
+			return fmt.Errorf("file \"%s\" could not be read: %w", j.in, err)
+		}
+		if err := j.build(data); err != nil {
+			return err
+		}
 	}
+	return nil
 }
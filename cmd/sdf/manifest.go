@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+// Manifest describes a set of sdf jobs, paths are relative to the manifest
+type Manifest struct {
+	Jobs []ManifestJob `json:"jobs"`
+}
+
+// ManifestJob is a single input to output sdf generation
+type ManifestJob struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	sdf.Options
+}
+
+func loadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest \"%s\" could not be read: %w", path, err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("manifest \"%s\" could not be parsed: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range m.Jobs {
+		j := &m.Jobs[i]
+		if j.Input == "" || j.Output == "" {
+			return nil, fmt.Errorf("manifest job %d is missing input or output", i)
+		}
+		if !filepath.IsAbs(j.Input) {
+			j.Input = filepath.Join(dir, j.Input)
+		}
+		if !filepath.IsAbs(j.Output) {
+			j.Output = filepath.Join(dir, j.Output)
+		}
+	}
+	return &m, nil
+}
+
+// order sorts the jobs so that jobs consuming the output of another job are
+// built after it, keeping manifest order otherwise
+func (m *Manifest) order() ([]ManifestJob, error) {
+	producers := map[string]int{}
+	for i, j := range m.Jobs {
+		if other, ok := producers[j.Output]; ok {
+			return nil, fmt.Errorf("jobs %d and %d both output \"%s\"", other, i, j.Output)
+		}
+		producers[j.Output] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	marks := make([]int, len(m.Jobs))
+	ordered := make([]ManifestJob, 0, len(m.Jobs))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch marks[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through \"%s\"", m.Jobs[i].Output)
+		case done:
+			return nil
+		}
+		marks[i] = visiting
+		if dep, ok := producers[m.Jobs[i].Input]; ok {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[i] = done
+		ordered = append(ordered, m.Jobs[i])
+		return nil
+	}
+	for i := range m.Jobs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// cacheKey hashes the input content together with the options, with the
+// defaults filled in so leaving one out does not change the key
+func cacheKey(data []byte, opts sdf.Options) (string, error) {
+	if err := opts.Normalize(); err != nil {
+		return "", err
+	}
+	optsData, err := json.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write(data)
+	hash.Write(optsData)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func loadCache(path string) map[string]string {
+	cache := map[string]string{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	// A broken cache only means a full rebuild
+	json.Unmarshal(data, &cache)
+	return cache
+}
+
+func saveCache(path string, cache map[string]string) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("cache \"%s\" could not be written: %w", path, err)
+	}
+	return nil
+}
+
+func build(args []string) error {
+	var cacheFile string
+	var force bool
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	flags.StringVar(&cacheFile, "cache", "", "the cache file, defaults to .sdfcache.json next to the manifest")
+	flags.BoolVar(&force, "force", false, "rebuild every job regardless of the cache")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: sdf build [flags] manifest.json")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(-1)
+	}
+
+	manifest, err := loadManifest(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	jobs, err := manifest.order()
+	if err != nil {
+		return err
+	}
+
+	if cacheFile == "" {
+		cacheFile = filepath.Join(filepath.Dir(flags.Arg(0)), ".sdfcache.json")
+	}
+	cache := loadCache(cacheFile)
+
+	var buildErr error
+	for _, mj := range jobs {
+		data, err := ioutil.ReadFile(mj.Input)
+		if err != nil {
+			buildErr = fmt.Errorf("file \"%s\" could not be read: %w", mj.Input, err)
+			break
+		}
+		key, err := cacheKey(data, mj.Options)
+		if err != nil {
+			buildErr = err
+			break
+		}
+		if _, err := os.Stat(mj.Output); err == nil && !force && cache[mj.Output] == key {
+			fmt.Printf("cached %s -> %s\n", mj.Input, mj.Output)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(mj.Output), 0755); err != nil {
+			buildErr = fmt.Errorf("output directory for \"%s\" could not be created: %w", mj.Output, err)
+			break
+		}
+
+		start := time.Now()
+		j := job{in: mj.Input, out: mj.Output, opts: mj.Options}
+		if err := j.build(data); err != nil {
+			delete(cache, mj.Output)
+			buildErr = err
+			break
+		}
+		cache[mj.Output] = key
+		fmt.Printf("built  %s -> %s (%s)\n", j.in, j.out, time.Since(start).Round(time.Millisecond))
+	}
+
+	if err := saveCache(cacheFile, cache); err != nil && buildErr == nil {
+		buildErr = err
+	}
+	return buildErr
+}
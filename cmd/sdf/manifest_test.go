@@ -0,0 +1,182 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+func testManifest(jobs ...[2]string) *Manifest {
+	m := &Manifest{}
+	for _, j := range jobs {
+		m.Jobs = append(m.Jobs, ManifestJob{Input: j[0], Output: j[1]})
+	}
+	return m
+}
+
+func TestManifestOrder(t *testing.T) {
+	// c consumes b which consumes a, d stands alone
+	m := testManifest(
+		[2]string{"b.png", "c.png"},
+		[2]string{"d.png", "e.png"},
+		[2]string{"a.png", "b.png"},
+		[2]string{"src.png", "a.png"},
+	)
+	jobs, err := m.order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, j := range jobs {
+		got = append(got, j.Output)
+	}
+	want := []string{"a.png", "b.png", "c.png", "e.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("built %v, want %v", got, want)
+	}
+
+	cycle := testManifest([2]string{"a.png", "b.png"}, [2]string{"b.png", "a.png"})
+	if _, err := cycle.order(); err == nil {
+		t.Fatal("dependency cycle ordered")
+	}
+	twice := testManifest([2]string{"a.png", "c.png"}, [2]string{"b.png", "c.png"})
+	if _, err := twice.order(); err == nil {
+		t.Fatal("two jobs with the same output ordered")
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	data := `{"jobs": [{"input": "in/a.png", "output": "/abs/a.png", "spread": 8, "algorithm": "brute"}]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ManifestJob{
+		Input:   filepath.Join(dir, "in", "a.png"),
+		Output:  "/abs/a.png",
+		Options: sdf.Options{Spread: 8, Algorithm: sdf.AlgorithmBrute},
+	}
+	if len(m.Jobs) != 1 || m.Jobs[0] != want {
+		t.Fatalf("loaded %+v, want %+v", m.Jobs, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"jobs": [{"input": "a.png"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifest(path); err == nil {
+		t.Fatal("job without output loaded")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	data := []byte("input")
+	key, err := cacheKey(data, sdf.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := sdf.Options{
+		Spread:    sdf.DefaultSpread,
+		Channel:   sdf.ChannelRed,
+		Scale:     1,
+		Algorithm: sdf.Algorithm8SSEDT,
+	}
+	if k, err := cacheKey(data, defaults); err != nil || k != key {
+		t.Fatalf("defaults given changed the key: %v", err)
+	}
+	if k, _ := cacheKey(data, sdf.Options{Scale: 2}); k == key {
+		t.Fatal("options kept the key")
+	}
+	if k, _ := cacheKey([]byte("other"), sdf.Options{}); k == key {
+		t.Fatal("input kept the key")
+	}
+	if _, err := cacheKey(data, sdf.Options{Channel: "hue"}); err == nil {
+		t.Fatal("invalid options hashed")
+	}
+}
+
+// writeInput saves a png with a filled square, shifted by offset
+func writeInput(t *testing.T, path string, offset int) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for y := 4; y < 12; y++ {
+		for x := 4 + offset; x < 12+offset; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	if err := savePNG(img, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.json")
+	writeManifest := func(jobs string) {
+		t.Helper()
+		if err := ioutil.WriteFile(manifest, []byte(`{"jobs": [`+jobs+`]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeInput(t, filepath.Join(dir, "a.png"), 0)
+	writeManifest(`{"input": "a.png", "output": "out/a.png"}, {"input": "out/a.png", "output": "out/b.png", "scale": 2}`)
+
+	// Outputs are marked old after every build, a rebuild makes them new
+	old := time.Now().Add(-time.Hour)
+	built := func() []bool {
+		t.Helper()
+		if err := build([]string{manifest}); err != nil {
+			t.Fatal(err)
+		}
+		var rebuilt []bool
+		for _, name := range []string{"a.png", "b.png"} {
+			path := filepath.Join(dir, "out", name)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rebuilt = append(rebuilt, info.ModTime().After(old.Add(time.Minute)))
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rebuilt
+	}
+	steps := []struct {
+		name   string
+		change func()
+		want   []bool
+	}{
+		{"first build", func() {}, []bool{true, true}},
+		{"unchanged", func() {}, []bool{false, false}},
+		{"defaults given", func() {
+			writeManifest(`{"input": "a.png", "output": "out/a.png", "channel": "r", "scale": 1}, {"input": "out/a.png", "output": "out/b.png", "scale": 2}`)
+		}, []bool{false, false}},
+		{"options changed", func() {
+			writeManifest(`{"input": "a.png", "output": "out/a.png"}, {"input": "out/a.png", "output": "out/b.png", "scale": 4}`)
+		}, []bool{false, true}},
+		{"input changed", func() {
+			writeInput(t, filepath.Join(dir, "a.png"), 2)
+		}, []bool{true, true}},
+		{"output removed", func() {
+			os.Remove(filepath.Join(dir, "out", "b.png"))
+		}, []bool{false, true}},
+	}
+	for _, s := range steps {
+		s.change()
+		if got := built(); !reflect.DeepEqual(got, s.want) {
+			t.Fatalf("%s rebuilt %v, want %v", s.name, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+const (
+	previewGutter = 4
+	previewLabel  = 16
+)
+
+// variant maps a signed distance, in output pixels, to coverage
+type variant struct {
+	name     string
+	coverage func(dist, outline float64) float64
+}
+
+var variants = []variant{
+	{
+		name: "threshold",
+		coverage: func(dist, outline float64) float64 {
+			if dist >= 0 {
+				return 1
+			}
+			return 0
+		},
+	},
+	{
+		name: "outline",
+		coverage: func(dist, outline float64) float64 {
+			return clamp(outline/2+0.5-math.Abs(dist), 0, 1)
+		},
+	},
+	{
+		name: "soft",
+		coverage: func(dist, outline float64) float64 {
+			return clamp(dist+0.5, 0, 1)
+		},
+	},
+}
+
+func preview(args []string) error {
+	var inFile, outFile, scaleList string
+	var mask bool
+	var spread, outline float64
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	flags.StringVar(&inFile, "in", "", "the sdf png to preview")
+	flags.StringVar(&outFile, "out", "", "the png to output the contact sheet to")
+	flags.StringVar(&scaleList, "scales", "1,4,16", "comma separated magnifications")
+	flags.BoolVar(&mask, "mask", false, "treat the input as a mask and generate the sdf first")
+	flags.Float64Var(&spread, "spread", 0, "the spread of the field in pixels, inferred if 0")
+	flags.Float64Var(&outline, "outline", 2, "the outline width in output pixels")
+	flags.Parse(args)
+
+	if inFile == "" || outFile == "" {
+		flags.PrintDefaults()
+		os.Exit(-1)
+	}
+
+	var scales []int
+	for _, s := range strings.Split(scaleList, ",") {
+		scale, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || scale < 1 {
+			return fmt.Errorf("invalid scale \"%s\"", s)
+		}
+		scales = append(scales, scale)
+	}
+
+	field, err := loadPNG(inFile)
+	if err != nil {
+		return err
+	}
+	if mask {
+		if field, err = sdf.Generate(field); err != nil {
+			return err
+		}
+	}
+	if spread <= 0 {
+		spread = sdf.Inspect(field, 256).Spread
+		if spread <= 0 {
+			return fmt.Errorf("could not infer spread of \"%s\", use -spread", inFile)
+		}
+	}
+
+	return savePNG(contactSheet(field, scales, spread, outline), outFile)
+}
+
+// contactSheet renders every variant of the field in columns, one row per
+// magnification
+func contactSheet(field image.Image, scales []int, spread, outline float64) image.Image {
+	fw, fh := field.Bounds().Dx(), field.Bounds().Dy()
+	var width, height int
+	for _, scale := range scales {
+		height += previewLabel + fh*scale + previewGutter
+		if w := len(variants)*(fw*scale+previewGutter) + previewGutter; w > width {
+			width = w
+		}
+	}
+	height += previewGutter
+
+	sheet := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.Gray{Y: 64}), image.ZP, draw.Src)
+
+	vals := make([]float64, fw*fh)
+	for y := 0; y < fh; y++ {
+		for x := 0; x < fw; x++ {
+			r, _, _, _ := field.At(field.Bounds().Min.X+x, field.Bounds().Min.Y+y).RGBA()
+			vals[(y*fw)+x] = float64(r) / 257
+		}
+	}
+	sample := func(x, y float64) float64 {
+		x = clamp(x, 0, float64(fw-1))
+		y = clamp(y, 0, float64(fh-1))
+		x0, y0 := int(x), int(y)
+		x1, y1 := x0+1, y0+1
+		if x1 >= fw {
+			x1 = fw - 1
+		}
+		if y1 >= fh {
+			y1 = fh - 1
+		}
+		tx, ty := x-float64(x0), y-float64(y0)
+		top := vals[(y0*fw)+x0]*(1-tx) + vals[(y0*fw)+x1]*tx
+		bottom := vals[(y1*fw)+x0]*(1-tx) + vals[(y1*fw)+x1]*tx
+		return top*(1-ty) + bottom*ty
+	}
+
+	oy := previewGutter
+	for _, scale := range scales {
+		ox := previewGutter
+		for _, v := range variants {
+			label(sheet, ox, oy+previewLabel-4, fmt.Sprintf("%dx %s", scale, v.name))
+			cell := image.Rect(ox, oy+previewLabel, ox+fw*scale, oy+previewLabel+fh*scale)
+			for y := cell.Min.Y; y < cell.Max.Y; y++ {
+				sy := (float64(y-cell.Min.Y)+0.5)/float64(scale) - 0.5
+				for x := cell.Min.X; x < cell.Max.X; x++ {
+					sx := (float64(x-cell.Min.X)+0.5)/float64(scale) - 0.5
+					dist := (sample(sx, sy) - 128) * spread / 128 * float64(scale)
+					sheet.SetGray(x, y, color.Gray{Y: uint8(v.coverage(dist, outline) * 255)})
+				}
+			}
+			ox += fw*scale + previewGutter
+		}
+		oy += previewLabel + fh*scale + previewGutter
+	}
+
+	return sheet
+}
+
+func label(dst draw.Image, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.White,
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
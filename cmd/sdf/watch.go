@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+type job struct {
+	in, out string
+	opts    sdf.Options
+}
+
+// listJobs pairs every input png with its output, inPath and outPath are
+// either both files or both directories
+func listJobs(inPath, outPath string, opts sdf.Options) ([]job, error) {
+	info, err := os.Stat(inPath)
+	if err != nil {
+		return nil, fmt.Errorf("input \"%s\" could not be read: %w", inPath, err)
+	}
+
+	if !info.IsDir() {
+		if filepath.Ext(inPath) != ".png" || filepath.Ext(outPath) != ".png" {
+			return nil, fmt.Errorf("in/out file should be png")
+		}
+		return []job{{in: inPath, out: outPath, opts: opts}}, nil
+	}
+
+	if err := os.MkdirAll(outPath, 0755); err != nil {
+		return nil, fmt.Errorf("output directory \"%s\" could not be created: %w", outPath, err)
+	}
+	matches, err := filepath.Glob(filepath.Join(inPath, "*.png"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	jobs := make([]job, 0, len(matches))
+	for _, m := range matches {
+		jobs = append(jobs, job{
+			in:   m,
+			out:  filepath.Join(outPath, filepath.Base(m)),
+			opts: opts,
+		})
+	}
+	return jobs, nil
+}
+
+// build generates the sdf for an already read input
+func (j job) build(data []byte) error {
+	srcPNG, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("file \"%s\" could not be decoded: %w", j.in, err)
+	}
+
+	outPNG, err := sdf.GenerateWithOptions(srcPNG, j.opts)
+	if err != nil {
+		return err
+	}
+
+	return savePNG(outPNG, j.out)
+}
+
+type watchState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// watch polls the inputs and rebuilds every output whose input content
+// changed, modification times are only used to avoid rehashing
+func watch(inPath, outPath string, opts sdf.Options, interval time.Duration) error {
+	states := map[string]*watchState{}
+	for {
+		jobs, err := listJobs(inPath, outPath, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, j := range jobs {
+			info, err := os.Stat(j.in)
+			if err != nil {
+				// Removed between listing and stat, picked up next poll
+				continue
+			}
+
+			state, ok := states[j.in]
+			if ok && info.ModTime().Equal(state.modTime) && info.Size() == state.size {
+				continue
+			}
+			if !ok {
+				state = &watchState{}
+				states[j.in] = state
+			}
+
+			data, err := ioutil.ReadFile(j.in)
+			if err != nil {
+				fmt.Printf("error  %s: %s\n", j.in, err.Error())
+				continue
+			}
+			state.modTime = info.ModTime()
+			state.size = info.Size()
+
+			hash := sha256.Sum256(data)
+			if ok && hash == state.hash {
+				continue
+			}
+			state.hash = hash
+
+			start := time.Now()
+			if err := j.build(data); err != nil {
+				fmt.Printf("error  %s: %s\n", j.in, err.Error())
+				continue
+			}
+			fmt.Printf("built  %s -> %s (%s)\n", j.in, j.out, time.Since(start).Round(time.Millisecond))
+		}
+
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,121 @@
+// Command blocks generates the Unicode block table of pkg/fontloader from
+// Blocks.txt of the Unicode Character Database
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultIn = "https://www.unicode.org/Public/14.0.0/ucd/Blocks.txt"
+
+var versionLine = regexp.MustCompile(`^# Blocks-([0-9.]+)\.txt`)
+
+type block struct {
+	name        string
+	first, last uint64
+}
+
+// open reads a local Blocks.txt or fetches it
+func open(in string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(in, "http://") && !strings.HasPrefix(in, "https://") {
+		return os.Open(in)
+	}
+	resp, err := http.Get(in)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not fetch \"%s\": %s", in, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// parse reads the version and the "first..last; name" lines
+func parse(r io.Reader) (string, []block, error) {
+	var version string
+	var blocks []block
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := versionLine.FindStringSubmatch(line); m != nil {
+			version = m[1]
+		}
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ";", 2)
+		bounds := strings.SplitN(strings.TrimSpace(parts[0]), "..", 2)
+		if len(parts) != 2 || len(bounds) != 2 {
+			return "", nil, fmt.Errorf("invalid line \"%s\"", line)
+		}
+		first, err := strconv.ParseUint(bounds[0], 16, 32)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid line \"%s\": %w", line, err)
+		}
+		last, err := strconv.ParseUint(bounds[1], 16, 32)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid line \"%s\": %w", line, err)
+		}
+		blocks = append(blocks, block{name: strings.TrimSpace(parts[1]), first: first, last: last})
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	if version == "" || len(blocks) == 0 {
+		return "", nil, fmt.Errorf("not a Blocks.txt")
+	}
+	return version, blocks, nil
+}
+
+func main() {
+	var in, out string
+	flag.StringVar(&in, "in", defaultIn, "the Blocks.txt to read, a path or url")
+	flag.StringVar(&out, "out", "blocks.go", "the go file to write")
+	flag.Parse()
+
+	r, err := open(in)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	version, blocks, err := parse(r)
+	r.Close()
+	if err != nil {
+		fmt.Printf("could not parse \"%s\": %s\n", in, err.Error())
+		os.Exit(-1)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by internal/gen/blocks from Unicode %s Blocks.txt. DO NOT EDIT.\n\n", version)
+	buf.WriteString("package fontloader\n\n")
+	buf.WriteString("// unicodeBlocks are the Unicode blocks in order\n")
+	buf.WriteString("var unicodeBlocks = []unicodeBlock{\n")
+	for _, b := range blocks {
+		fmt.Fprintf(&buf, "\t{%q, 0x%04X, 0x%04X},\n", b.name, b.first, b.last)
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+	if err := ioutil.WriteFile(out, src, 0644); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(-1)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
@@ -306,13 +307,29 @@ const width = 1920
 const height = 1080
 
 func main() {
+	subpixel := flag.Bool("subpixel", false, "render text per subpixel for horizontal RGB displays, sharper at small sizes but without the drop shadow")
+	flag.Parse()
+
 	foo.Foo()
 
-	fontmap, err := fontloader.LoadTTF("pragmono.ttf")
+	font, err := fontloader.LoadFont("pragmono.ttf")
 	if err != nil {
 		panic(err)
 	}
-	if err := fontmap.Save("out.png"); err != nil {
+	fontOpts := fontloader.LoadOptions{
+		Ranges: []fontloader.RuneRange{{First: 32, Last: 255}},
+		Effects: []fontloader.Effect{
+			fontloader.DropShadow{OffsetX: 1, OffsetY: 1, Color: color.NRGBA{A: 255}},
+		},
+	}
+	fontFrag := "text.frag"
+	if *subpixel {
+		fontOpts.Mode = fontloader.ModeLCD
+		fontOpts.Effects = nil
+		fontFrag = "text_lcd.frag"
+	}
+	fontmap, err := font.LRUAtlas(fontOpts)
+	if err != nil {
 		panic(err)
 	}
 
@@ -408,13 +425,14 @@ func main() {
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
 	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(fontmap.Image.Bounds().Dx()), int32(fontmap.Image.Bounds().Dy()), 0,
 		gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(fontmap.Image.Pix))
+	fontmap.Dirty()
 
 	{
 		vertSource, err := ioutil.ReadFile("text.vert")
 		if err != nil {
 			panic(err)
 		}
-		fragSource, err := ioutil.ReadFile("text.frag")
+		fragSource, err := ioutil.ReadFile(fontFrag)
 		if err != nil {
 			panic(err)
 		}
@@ -444,13 +462,17 @@ func main() {
 	gl.BindVertexArray(textVao)
 	gl.GenBuffers(1, &textVbo)
 	gl.BindBuffer(gl.ARRAY_BUFFER, textVbo)
-	// sizeof(float)*6(vertices)*4(fields)
-	gl.BufferData(gl.ARRAY_BUFFER, 4*6*4, nil, gl.DYNAMIC_DRAW)
+	// sizeof(float)*6(vertices)*5(fields)
+	gl.BufferData(gl.ARRAY_BUFFER, 4*6*5, nil, gl.DYNAMIC_DRAW)
 	{
 		vertAttrib := uint32(gl.GetAttribLocation(fontProgram, gl.Str("vertex\x00")))
 		gl.EnableVertexAttribArray(vertAttrib)
-		// sizeof(float)*4(fields)
-		gl.VertexAttribPointer(vertAttrib, 4, gl.FLOAT, false, 4*4, gl.PtrOffset(0))
+		// sizeof(float)*5(fields)
+		gl.VertexAttribPointer(vertAttrib, 4, gl.FLOAT, false, 5*4, gl.PtrOffset(0))
+
+		coloredAttrib := uint32(gl.GetAttribLocation(fontProgram, gl.Str("colored\x00")))
+		gl.EnableVertexAttribArray(coloredAttrib)
+		gl.VertexAttribPointer(coloredAttrib, 1, gl.FLOAT, false, 5*4, gl.PtrOffset(4*4))
 	}
 	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
 	gl.BindVertexArray(0)
@@ -604,6 +626,12 @@ func main() {
 				x, y int
 				str  string
 			}
+			// textVertex is a position and texture coordinate, and whether
+			// the glyph is drawn untinted in its own colors
+			type textVertex struct {
+				vertex  mgl32.Vec4
+				colored float32
+			}
 			renderStrings := func(messages []message) {
 				gl.UseProgram(fontProgram)
 				colorUniform := int32(gl.GetUniformLocation(fontProgram, gl.Str("textColor\x00")))
@@ -611,50 +639,80 @@ func main() {
 				gl.ActiveTexture(gl.TEXTURE0)
 				gl.BindTexture(gl.TEXTURE_2D, fontTexture)
 				gl.BindVertexArray(textVao)
-				vertices := make([]mgl32.Vec4, 0)
+				fontmap.Frame()
+				vertices := make([]textVertex, 0)
+				atlasW := float32(fontmap.Image.Bounds().Dx())
+				atlasH := float32(fontmap.Image.Bounds().Dy())
 				for _, m := range messages {
 					ox := float32(m.x)
-					oy := float32(720 - m.y)
-					stepX := float32(1.0 / 32.0)
-					stepY := float32(1.0 / 16.0)
-					sX := float32(8)
-					sY := float32(16)
+					baseline := float32(720-m.y) - float32(math.Round(fontmap.Ascent))
+					var prev rune
 					for _, r := range m.str {
-						offx := float32((r-33)%32) * stepX // - starting rune, mod 32 max characters times texture step
-						offy := float32((r-33)/32) * stepY // - starting rune, div 32 max characters times texture step
-						xpos := ox
-						ypos := oy - sY
-						vertices = append(vertices, []mgl32.Vec4{
-							{xpos, ypos + sY, offx, offy},
-							{xpos, ypos, offx, offy + stepY},
-							{xpos + sX, ypos, offx + stepX, offy + stepY},
-							{xpos, ypos + sY, offx, offy},
-							{xpos + sX, ypos, offx + stepX, offy + stepY},
-							{xpos + sX, ypos + sY, offx + stepX, offy},
+						g, ok := fontmap.Glyph(r)
+						if !ok {
+							continue
+						}
+						ox += float32(fontmap.Kern(prev, r))
+						prev = r
+						offx := float32(g.X) / atlasW
+						offy := float32(g.Y) / atlasH
+						stepX := float32(g.Width) / atlasW
+						stepY := float32(g.Height) / atlasH
+						sX := float32(g.Width)
+						sY := float32(g.Height)
+						xpos := ox + float32(g.Bearing)
+						// Subpixel texels only line up with whole pixels
+						if *subpixel {
+							xpos = float32(math.Round(float64(xpos)))
+						}
+						ypos := baseline + float32(g.Baseline) - sY
+						var colored float32
+						if g.Color {
+							colored = 1
+						}
+						vertices = append(vertices, []textVertex{
+							{mgl32.Vec4{xpos, ypos + sY, offx, offy}, colored},
+							{mgl32.Vec4{xpos, ypos, offx, offy + stepY}, colored},
+							{mgl32.Vec4{xpos + sX, ypos, offx + stepX, offy + stepY}, colored},
+							{mgl32.Vec4{xpos, ypos + sY, offx, offy}, colored},
+							{mgl32.Vec4{xpos + sX, ypos, offx + stepX, offy + stepY}, colored},
+							{mgl32.Vec4{xpos + sX, ypos + sY, offx + stepX, offy}, colored},
 						}...)
-						ox += sX
+						ox += float32(g.Advance)
 					}
 				}
+				// Upload only the cells rendered for this frame
+				gl.PixelStorei(gl.UNPACK_ROW_LENGTH, int32(fontmap.Image.Stride/4))
+				for _, d := range fontmap.Dirty() {
+					gl.TexSubImage2D(gl.TEXTURE_2D, 0, int32(d.Min.X), int32(d.Min.Y), int32(d.Dx()), int32(d.Dy()),
+						gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(fontmap.Image.Pix[fontmap.Image.PixOffset(d.Min.X, d.Min.Y):]))
+				}
+				gl.PixelStorei(gl.UNPACK_ROW_LENGTH, 0)
 				gl.BindBuffer(gl.ARRAY_BUFFER, textVbo)
-				// vertices*3fields*sizeof(float)
-				gl.BufferData(gl.ARRAY_BUFFER, (len(vertices)*4)*4, gl.Ptr(vertices[:]), gl.DYNAMIC_DRAW)
+				// vertices*5fields*sizeof(float)
+				gl.BufferData(gl.ARRAY_BUFFER, (len(vertices)*5)*4, gl.Ptr(vertices[:]), gl.DYNAMIC_DRAW)
 				gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+				if *subpixel {
+					gl.BlendFunc(gl.ONE, gl.ONE_MINUS_SRC1_COLOR)
+				}
 				gl.DrawArrays(gl.TRIANGLES, 0, int32(len(vertices)))
+				gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
 				gl.BindTexture(gl.TEXTURE_2D, 0)
 			}
+			lineHeight := int(math.Ceil(fontmap.LineHeight))
 			messages := []message{
 				{
 					x: 2, y: 2,
 					str: fmt.Sprintf("FPS: %d (%dms) wave timing: %dms", fps, fts, wts),
 				},
 				{
-					x: 2, y: 20,
+					x: 2, y: 2 + lineHeight,
 					str: "åäöÅÄÖ€$£#\"\\//[]{}",
 				},
 			}
 			for i := 0; i < 20; i++ {
 				messages = append(messages, message{
-					x: 2, y: 38 + (i * 18),
+					x: 2, y: 2 + ((i + 2) * lineHeight),
 					str: "Lorem ipsum dolor sit amet, consectetur adipiscing elit. Praesent commodo aliquam erat, quis blandit nisi interdum mollis.",
 				})
 			}
@@ -0,0 +1,814 @@
+package fontloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BMFontFormat is one of the AngelCode BMFont .fnt variants
+type BMFontFormat string
+
+// Available formats
+const (
+	BMFontText   BMFontFormat = "text"
+	BMFontXML    BMFontFormat = "xml"
+	BMFontBinary BMFontFormat = "binary"
+)
+
+// BMFont channel contents, the outline (1) and glyph with outline (2) are
+// read as the glyph
+const (
+	bmChannelGlyph = 0
+	bmChannelZero  = 3
+	bmChannelOne   = 4
+)
+
+type bmInfo struct {
+	Face     string `xml:"face,attr"`
+	Size     int    `xml:"size,attr"`
+	Bold     int    `xml:"bold,attr"`
+	Italic   int    `xml:"italic,attr"`
+	Charset  string `xml:"charset,attr"`
+	Unicode  int    `xml:"unicode,attr"`
+	StretchH int    `xml:"stretchH,attr"`
+	Smooth   int    `xml:"smooth,attr"`
+	AA       int    `xml:"aa,attr"`
+	Padding  string `xml:"padding,attr"`
+	Spacing  string `xml:"spacing,attr"`
+	Outline  int    `xml:"outline,attr"`
+}
+
+type bmCommon struct {
+	LineHeight int `xml:"lineHeight,attr"`
+	Base       int `xml:"base,attr"`
+	ScaleW     int `xml:"scaleW,attr"`
+	ScaleH     int `xml:"scaleH,attr"`
+	Pages      int `xml:"pages,attr"`
+	Packed     int `xml:"packed,attr"`
+	AlphaChnl  int `xml:"alphaChnl,attr"`
+	RedChnl    int `xml:"redChnl,attr"`
+	GreenChnl  int `xml:"greenChnl,attr"`
+	BlueChnl   int `xml:"blueChnl,attr"`
+}
+
+type bmPage struct {
+	ID   int    `xml:"id,attr"`
+	File string `xml:"file,attr"`
+}
+
+type bmChar struct {
+	ID       int `xml:"id,attr"`
+	X        int `xml:"x,attr"`
+	Y        int `xml:"y,attr"`
+	Width    int `xml:"width,attr"`
+	Height   int `xml:"height,attr"`
+	XOffset  int `xml:"xoffset,attr"`
+	YOffset  int `xml:"yoffset,attr"`
+	XAdvance int `xml:"xadvance,attr"`
+	Page     int `xml:"page,attr"`
+	Chnl     int `xml:"chnl,attr"`
+}
+
+// bmDistanceField is the block msdf-bmfont adds for distance field atlases,
+// the range spans both sides of the edge
+type bmDistanceField struct {
+	FieldType     string `xml:"fieldType,attr"`
+	DistanceRange int    `xml:"distanceRange,attr"`
+}
+
+type bmKerning struct {
+	First  int `xml:"first,attr"`
+	Second int `xml:"second,attr"`
+	Amount int `xml:"amount,attr"`
+}
+
+// bmFont is the content shared by all three formats
+type bmFont struct {
+	XMLName xml.Name `xml:"font"`
+	Info    bmInfo   `xml:"info"`
+	Common  bmCommon `xml:"common"`
+	// DistanceField is not in the binary format, where the mode is told by
+	// the channels
+	DistanceField *bmDistanceField `xml:"distanceField,omitempty"`
+	Pages         []bmPage         `xml:"pages>page"`
+	Chars         []bmChar         `xml:"chars>char"`
+	Kernings      []bmKerning      `xml:"kernings>kerning"`
+}
+
+func round(v float64) int {
+	return int(math.Round(v))
+}
+
+// bmFont converts the charset, pages are named after file
+func (c *Charset) bmFont(file string) *bmFont {
+	f := &bmFont{
+		Info: bmInfo{
+			Face:     c.Face,
+			Size:     round(c.Size),
+			Unicode:  1,
+			StretchH: 100,
+			Smooth:   1,
+			AA:       1,
+			Padding:  fmt.Sprintf("%d,%d,%d,%d", c.Padding, c.Padding, c.Padding, c.Padding),
+			Spacing:  "0,0",
+		},
+		Common: bmCommon{
+			LineHeight: round(c.LineHeight),
+			Base:       round(c.Ascent),
+			Pages:      len(c.Pages),
+			AlphaChnl:  bmChannelGlyph,
+			RedChnl:    bmChannelOne,
+			GreenChnl:  bmChannelOne,
+			BlueChnl:   bmChannelOne,
+		},
+	}
+	if c.Mode == ModeLCD {
+		f.Common.RedChnl = bmChannelGlyph
+		f.Common.GreenChnl = bmChannelGlyph
+		f.Common.BlueChnl = bmChannelGlyph
+	} else if c.Mode != ModeBitmap {
+		f.Common.AlphaChnl = bmChannelOne
+		f.Common.RedChnl = bmChannelGlyph
+		f.Common.GreenChnl = bmChannelGlyph
+		f.Common.BlueChnl = bmChannelGlyph
+		f.DistanceField = &bmDistanceField{
+			FieldType:     string(c.Mode),
+			DistanceRange: round(c.Spread * 2),
+		}
+	}
+	for _, g := range c.Glyphs {
+		if g.Color {
+			f.Common.RedChnl = bmChannelGlyph
+			f.Common.GreenChnl = bmChannelGlyph
+			f.Common.BlueChnl = bmChannelGlyph
+			break
+		}
+	}
+	f.Common.ScaleW, f.Common.ScaleH = c.pageBounds()
+
+	for i := range c.Pages {
+		f.Pages = append(f.Pages, bmPage{ID: i, File: filepath.Base(PagePath(file, i))})
+	}
+	for _, r := range c.runes() {
+		g := c.Glyphs[r]
+		f.Chars = append(f.Chars, bmChar{
+			ID:       int(g.Rune),
+			X:        g.X,
+			Y:        g.Y,
+			Width:    g.Width,
+			Height:   g.Height,
+			XOffset:  g.Bearing,
+			YOffset:  f.Common.Base - g.Baseline,
+			XAdvance: round(g.Advance),
+			Page:     g.Page,
+			Chnl:     15,
+		})
+	}
+	for _, k := range c.Kerning {
+		if amount := round(k.Amount); amount != 0 {
+			f.Kernings = append(f.Kernings, bmKerning{
+				First:  int(k.First),
+				Second: int(k.Second),
+				Amount: amount,
+			})
+		}
+	}
+	return f
+}
+
+// runes lists the runes in the charset in order
+func (c *Charset) runes() []rune {
+	runes := make([]rune, 0, len(c.Glyphs))
+	for r := range c.Glyphs {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool {
+		return runes[i] < runes[j]
+	})
+	return runes
+}
+
+// pageBounds is the size of the largest page, BMFont has one size for all
+func (c *Charset) pageBounds() (int, int) {
+	var w, h int
+	for _, p := range c.Pages {
+		if p.Bounds().Dx() > w {
+			w = p.Bounds().Dx()
+		}
+		if p.Bounds().Dy() > h {
+			h = p.Bounds().Dy()
+		}
+	}
+	return w, h
+}
+
+// BMFontPagePath returns the first page SaveBMFont writes next to the .fnt
+// file, see PagePath for the others. They are apart from the pages of Save
+// as they are padded
+func BMFontPagePath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "_bm.png"
+}
+
+// SaveBMFont writes the charset as a BMFont .fnt file with its pages as png
+// next to it, pages smaller than the largest one are padded to its size
+func (c *Charset) SaveBMFont(path string, format BMFontFormat) error {
+	pageFile := BMFontPagePath(path)
+	f := c.bmFont(pageFile)
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case BMFontText:
+		err = f.writeText(&buf)
+	case BMFontXML:
+		err = f.writeXML(&buf)
+	case BMFontBinary:
+		err = f.writeBinary(&buf)
+	default:
+		return fmt.Errorf("unknown bmfont format \"%s\"", format)
+	}
+	if err != nil {
+		return fmt.Errorf("could not encode \"%s\": %w", path, err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("could not write file \"%s\": %w", path, err)
+	}
+
+	w, h := f.Common.ScaleW, f.Common.ScaleH
+	for i, p := range c.Pages {
+		img := p
+		if p.Bounds().Dx() != w || p.Bounds().Dy() != h {
+			img = image.NewRGBA(image.Rect(0, 0, w, h))
+			draw.Draw(img, p.Bounds(), p, image.ZP, draw.Src)
+		}
+		if err := savePNG(img, PagePath(pageFile, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *bmFont) writeText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	i := f.Info
+	fmt.Fprintf(b, "info face=%q size=%d bold=%d italic=%d charset=%q unicode=%d stretchH=%d smooth=%d aa=%d padding=%s spacing=%s outline=%d\n",
+		i.Face, i.Size, i.Bold, i.Italic, i.Charset, i.Unicode, i.StretchH, i.Smooth, i.AA, i.Padding, i.Spacing, i.Outline)
+	c := f.Common
+	fmt.Fprintf(b, "common lineHeight=%d base=%d scaleW=%d scaleH=%d pages=%d packed=%d alphaChnl=%d redChnl=%d greenChnl=%d blueChnl=%d\n",
+		c.LineHeight, c.Base, c.ScaleW, c.ScaleH, c.Pages, c.Packed, c.AlphaChnl, c.RedChnl, c.GreenChnl, c.BlueChnl)
+	if d := f.DistanceField; d != nil {
+		fmt.Fprintf(b, "distanceField fieldType=%s distanceRange=%d\n", d.FieldType, d.DistanceRange)
+	}
+	for _, p := range f.Pages {
+		fmt.Fprintf(b, "page id=%d file=%q\n", p.ID, p.File)
+	}
+	fmt.Fprintf(b, "chars count=%d\n", len(f.Chars))
+	for _, ch := range f.Chars {
+		fmt.Fprintf(b, "char id=%d x=%d y=%d width=%d height=%d xoffset=%d yoffset=%d xadvance=%d page=%d chnl=%d\n",
+			ch.ID, ch.X, ch.Y, ch.Width, ch.Height, ch.XOffset, ch.YOffset, ch.XAdvance, ch.Page, ch.Chnl)
+	}
+	if len(f.Kernings) > 0 {
+		fmt.Fprintf(b, "kernings count=%d\n", len(f.Kernings))
+		for _, k := range f.Kernings {
+			fmt.Fprintf(b, "kerning first=%d second=%d amount=%d\n", k.First, k.Second, k.Amount)
+		}
+	}
+	return b.Flush()
+}
+
+func (f *bmFont) writeXML(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeBinary writes version 3 of the binary format
+func (f *bmFont) writeBinary(w io.Writer) error {
+	var block bytes.Buffer
+	le := binary.LittleEndian
+	put := func(v interface{}) {
+		binary.Write(&block, le, v)
+	}
+	flush := func(kind uint8) error {
+		header := []byte{kind, 0, 0, 0, 0}
+		le.PutUint32(header[1:], uint32(block.Len()))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		_, err := block.WriteTo(w)
+		return err
+	}
+
+	if _, err := w.Write([]byte{'B', 'M', 'F', 3}); err != nil {
+		return err
+	}
+
+	i := f.Info
+	var bits uint8
+	if i.Smooth != 0 {
+		bits |= 1 << 0
+	}
+	if i.Unicode != 0 {
+		bits |= 1 << 1
+	}
+	if i.Italic != 0 {
+		bits |= 1 << 2
+	}
+	if i.Bold != 0 {
+		bits |= 1 << 3
+	}
+	padding := parseInts(i.Padding, 4)
+	spacing := parseInts(i.Spacing, 2)
+	put(int16(i.Size))
+	put(bits)
+	put(uint8(0))
+	put(uint16(i.StretchH))
+	put(uint8(i.AA))
+	for _, p := range padding {
+		put(uint8(p))
+	}
+	for _, s := range spacing {
+		put(uint8(s))
+	}
+	put(uint8(i.Outline))
+	block.WriteString(i.Face)
+	block.WriteByte(0)
+	if err := flush(1); err != nil {
+		return err
+	}
+
+	c := f.Common
+	put(uint16(c.LineHeight))
+	put(uint16(c.Base))
+	put(uint16(c.ScaleW))
+	put(uint16(c.ScaleH))
+	put(uint16(c.Pages))
+	put(uint8(c.Packed << 7))
+	put(uint8(c.AlphaChnl))
+	put(uint8(c.RedChnl))
+	put(uint8(c.GreenChnl))
+	put(uint8(c.BlueChnl))
+	if err := flush(2); err != nil {
+		return err
+	}
+
+	for _, p := range f.Pages {
+		block.WriteString(p.File)
+		block.WriteByte(0)
+	}
+	if err := flush(3); err != nil {
+		return err
+	}
+
+	for _, ch := range f.Chars {
+		put(uint32(ch.ID))
+		put(uint16(ch.X))
+		put(uint16(ch.Y))
+		put(uint16(ch.Width))
+		put(uint16(ch.Height))
+		put(int16(ch.XOffset))
+		put(int16(ch.YOffset))
+		put(int16(ch.XAdvance))
+		put(uint8(ch.Page))
+		put(uint8(ch.Chnl))
+	}
+	if err := flush(4); err != nil {
+		return err
+	}
+
+	if len(f.Kernings) > 0 {
+		for _, k := range f.Kernings {
+			put(uint32(k.First))
+			put(uint32(k.Second))
+			put(int16(k.Amount))
+		}
+		if err := flush(5); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseInts parses comma separated ints, always returning n values
+func parseInts(s string, n int) []int {
+	values := make([]int, n)
+	for i, part := range strings.SplitN(s, ",", n) {
+		values[i], _ = strconv.Atoi(strings.TrimSpace(part))
+	}
+	return values
+}
+
+var errBMFont = errors.New("malformed bmfont")
+
+// LoadBMFont reads a BMFont .fnt file in any of the formats together with its
+// pages, which are looked up relative to the .fnt file. Grey pages are spread
+// over the channels as the file says, pages packed a glyph per channel are
+// not supported
+func LoadBMFont(path string) (*Charset, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file \"%s\": %w", path, err)
+	}
+
+	var f *bmFont
+	switch trimmed := bytes.TrimSpace(data); {
+	case bytes.HasPrefix(data, []byte("BMF")):
+		f, err = readBinary(data)
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		f = &bmFont{}
+		err = xml.Unmarshal(data, f)
+	default:
+		f, err = readText(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse \"%s\": %w", path, err)
+	}
+
+	c, err := f.charset(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("could not load \"%s\": %w", path, err)
+	}
+	return c, nil
+}
+
+// readText parses lines of a tag followed by key=value pairs, values may be
+// quoted
+func readText(data []byte) (*bmFont, error) {
+	f := &bmFont{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		tag, attrs := splitTextLine(scanner.Text())
+		num := func(key string) int {
+			v, _ := strconv.Atoi(attrs[key])
+			return v
+		}
+		switch tag {
+		case "info":
+			f.Info = bmInfo{
+				Face:     attrs["face"],
+				Size:     num("size"),
+				Bold:     num("bold"),
+				Italic:   num("italic"),
+				Charset:  attrs["charset"],
+				Unicode:  num("unicode"),
+				StretchH: num("stretchH"),
+				Smooth:   num("smooth"),
+				AA:       num("aa"),
+				Padding:  attrs["padding"],
+				Spacing:  attrs["spacing"],
+				Outline:  num("outline"),
+			}
+		case "common":
+			f.Common = bmCommon{
+				LineHeight: num("lineHeight"),
+				Base:       num("base"),
+				ScaleW:     num("scaleW"),
+				ScaleH:     num("scaleH"),
+				Pages:      num("pages"),
+				Packed:     num("packed"),
+				AlphaChnl:  num("alphaChnl"),
+				RedChnl:    num("redChnl"),
+				GreenChnl:  num("greenChnl"),
+				BlueChnl:   num("blueChnl"),
+			}
+		case "distanceField":
+			f.DistanceField = &bmDistanceField{
+				FieldType:     attrs["fieldType"],
+				DistanceRange: num("distanceRange"),
+			}
+		case "page":
+			f.Pages = append(f.Pages, bmPage{ID: num("id"), File: attrs["file"]})
+		case "char":
+			f.Chars = append(f.Chars, bmChar{
+				ID:       num("id"),
+				X:        num("x"),
+				Y:        num("y"),
+				Width:    num("width"),
+				Height:   num("height"),
+				XOffset:  num("xoffset"),
+				YOffset:  num("yoffset"),
+				XAdvance: num("xadvance"),
+				Page:     num("page"),
+				Chnl:     num("chnl"),
+			})
+		case "kerning":
+			f.Kernings = append(f.Kernings, bmKerning{
+				First:  num("first"),
+				Second: num("second"),
+				Amount: num("amount"),
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func splitTextLine(line string) (string, map[string]string) {
+	attrs := map[string]string{}
+	line = strings.TrimSpace(line)
+	end := strings.IndexAny(line, " \t")
+	if end < 0 {
+		return line, attrs
+	}
+	tag, rest := line[:end], line[end:]
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := rest[:eq]
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			quote := strings.IndexByte(rest[1:], '"')
+			if quote < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:quote+1], rest[quote+2:]
+			}
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		attrs[key] = value
+	}
+	return tag, attrs
+}
+
+func readBinary(data []byte) (*bmFont, error) {
+	if len(data) < 4 || data[3] != 3 {
+		return nil, fmt.Errorf("%w: only version 3 of the binary format is supported", errBMFont)
+	}
+	le := binary.LittleEndian
+	f := &bmFont{}
+	data = data[4:]
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, errBMFont
+		}
+		kind, size := data[0], int(le.Uint32(data[1:]))
+		if len(data) < 5+size {
+			return nil, errBMFont
+		}
+		block := data[5 : 5+size]
+		data = data[5+size:]
+
+		switch kind {
+		case 1:
+			if len(block) < 14 {
+				return nil, errBMFont
+			}
+			bits := block[2]
+			f.Info = bmInfo{
+				Face:     string(bytes.TrimRight(block[14:], "\x00")),
+				Size:     int(int16(le.Uint16(block[0:]))),
+				Smooth:   int(bits >> 0 & 1),
+				Unicode:  int(bits >> 1 & 1),
+				Italic:   int(bits >> 2 & 1),
+				Bold:     int(bits >> 3 & 1),
+				StretchH: int(le.Uint16(block[4:])),
+				AA:       int(block[6]),
+				Padding:  fmt.Sprintf("%d,%d,%d,%d", block[7], block[8], block[9], block[10]),
+				Spacing:  fmt.Sprintf("%d,%d", block[11], block[12]),
+				Outline:  int(block[13]),
+			}
+		case 2:
+			if len(block) < 15 {
+				return nil, errBMFont
+			}
+			f.Common = bmCommon{
+				LineHeight: int(le.Uint16(block[0:])),
+				Base:       int(le.Uint16(block[2:])),
+				ScaleW:     int(le.Uint16(block[4:])),
+				ScaleH:     int(le.Uint16(block[6:])),
+				Pages:      int(le.Uint16(block[8:])),
+				Packed:     int(block[10] >> 7),
+				AlphaChnl:  int(block[11]),
+				RedChnl:    int(block[12]),
+				GreenChnl:  int(block[13]),
+				BlueChnl:   int(block[14]),
+			}
+		case 3:
+			for i, name := range bytes.Split(bytes.TrimRight(block, "\x00"), []byte{0}) {
+				f.Pages = append(f.Pages, bmPage{ID: i, File: string(name)})
+			}
+		case 4:
+			for ; len(block) >= 20; block = block[20:] {
+				f.Chars = append(f.Chars, bmChar{
+					ID:       int(le.Uint32(block[0:])),
+					X:        int(le.Uint16(block[4:])),
+					Y:        int(le.Uint16(block[6:])),
+					Width:    int(le.Uint16(block[8:])),
+					Height:   int(le.Uint16(block[10:])),
+					XOffset:  int(int16(le.Uint16(block[12:]))),
+					YOffset:  int(int16(le.Uint16(block[14:]))),
+					XAdvance: int(int16(le.Uint16(block[16:]))),
+					Page:     int(block[18]),
+					Chnl:     int(block[19]),
+				})
+			}
+		case 5:
+			for ; len(block) >= 10; block = block[10:] {
+				f.Kernings = append(f.Kernings, bmKerning{
+					First:  int(le.Uint32(block[0:])),
+					Second: int(le.Uint32(block[4:])),
+					Amount: int(int16(le.Uint16(block[8:]))),
+				})
+			}
+		}
+	}
+	return f, nil
+}
+
+// charset converts back, loading the pages from dir
+func (f *bmFont) charset(dir string) (*Charset, error) {
+	c := &Charset{
+		Face:    f.Info.Face,
+		Size:    math.Abs(float64(f.Info.Size)),
+		DPI:     72,
+		Mode:    ModeBitmap,
+		Padding: parseInts(f.Info.Padding, 4)[0],
+		VerticalMetrics: VerticalMetrics{
+			Ascent:     float64(f.Common.Base),
+			Descent:    float64(f.Common.LineHeight - f.Common.Base),
+			LineHeight: float64(f.Common.LineHeight),
+		},
+		Glyphs: make(map[rune]Glyph, len(f.Chars)),
+	}
+
+	// Packed pages hold a different glyph in each channel
+	if f.Common.Packed != 0 {
+		return nil, fmt.Errorf("%w: packed channels are not supported, export with packing off", errBMFont)
+	}
+
+	c.Pages = make([]*image.RGBA, len(f.Pages))
+	for _, p := range f.Pages {
+		if p.ID < 0 || p.ID >= len(f.Pages) {
+			return nil, fmt.Errorf("%w: page id %d out of range", errBMFont, p.ID)
+		}
+		img, err := loadPNG(filepath.Join(dir, p.File))
+		if err != nil {
+			return nil, err
+		}
+		c.Pages[p.ID] = f.Common.page(img)
+	}
+	for i, p := range c.Pages {
+		if p == nil {
+			return nil, fmt.Errorf("%w: page %d is missing", errBMFont, i)
+		}
+	}
+	if len(c.Pages) == 0 {
+		return nil, fmt.Errorf("%w: no pages", errBMFont)
+	}
+	c.Image = c.Pages[0]
+
+	switch d := f.DistanceField; {
+	case d != nil:
+		switch d.FieldType {
+		case "sdf", "psdf":
+			c.Mode = ModeSDF
+		case "msdf", "mtsdf":
+			c.Mode = ModeMSDF
+		default:
+			return nil, fmt.Errorf("%w: unknown distance field \"%s\"", errBMFont, d.FieldType)
+		}
+		c.Spread = float64(d.DistanceRange) / 2
+	case f.Common.AlphaChnl == bmChannelOne && f.Common.RedChnl == bmChannelGlyph:
+		// Distance fields are in the colors, the spread fills the padding
+		c.Mode = ModeMSDF
+		if grey(c.Pages) {
+			c.Mode = ModeSDF
+		}
+		c.Spread = float64(c.Padding)
+	}
+
+	for _, ch := range f.Chars {
+		if ch.Page < 0 || ch.Page >= len(c.Pages) {
+			return nil, fmt.Errorf("%w: char %d on page %d out of range", errBMFont, ch.ID, ch.Page)
+		}
+		c.Glyphs[rune(ch.ID)] = Glyph{
+			Rune:     rune(ch.ID),
+			Page:     ch.Page,
+			X:        ch.X,
+			Y:        ch.Y,
+			Width:    ch.Width,
+			Height:   ch.Height,
+			Bearing:  ch.XOffset,
+			Baseline: f.Common.Base - ch.YOffset,
+			Advance:  float64(ch.XAdvance),
+		}
+	}
+	for _, k := range f.Kernings {
+		c.Kerning = append(c.Kerning, Kerning{
+			First:  rune(k.First),
+			Second: rune(k.Second),
+			Amount: float64(k.Amount),
+		})
+	}
+	return c, nil
+}
+
+// grey reports whether every texel has the same red, green and blue
+func grey(pages []*image.RGBA) bool {
+	for _, p := range pages {
+		for i := 0; i+2 < len(p.Pix); i += 4 {
+			if p.Pix[i] != p.Pix[i+1] || p.Pix[i] != p.Pix[i+2] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// page converts a loaded page. Single channel pages are spread over the
+// channels as the common block says, others already hold every channel
+func (c *bmCommon) page(img image.Image) *image.RGBA {
+	if m := img.ColorModel(); m != color.GrayModel && m != color.Gray16Model {
+		return toRGBA(img)
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	channels := []int{c.RedChnl, c.GreenChnl, c.BlueChnl, c.AlphaChnl}
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			v := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			i := rgba.PixOffset(x, y)
+			for j, chnl := range channels {
+				switch chnl {
+				case bmChannelZero:
+					rgba.Pix[i+j] = 0
+				case bmChannelOne:
+					rgba.Pix[i+j] = 255
+				default:
+					rgba.Pix[i+j] = v
+				}
+			}
+		}
+	}
+	return rgba
+}
+
+func loadPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file \"%s\": %w", path, err)
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not png decode \"%s\": %w", path, err)
+	}
+	return img, nil
+}
+
+func decodePNG(r io.Reader) (*image.RGBA, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return toRGBA(img), nil
+}
+
+// toRGBA copies the channels as they are instead of premultiplying, atlases
+// keep straight color next to the alpha
+func toRGBA(img image.Image) *image.RGBA {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return img
+	case *image.NRGBA:
+		return &image.RGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect}
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
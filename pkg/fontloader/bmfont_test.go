@@ -0,0 +1,226 @@
+package fontloader
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testCharset is a small two page charset with kerning, pages are grey so
+// distance fields are told apart from msdf
+func testCharset(mode Mode) *Charset {
+	pages := []*image.RGBA{
+		image.NewRGBA(image.Rect(0, 0, 16, 16)),
+		image.NewRGBA(image.Rect(0, 0, 8, 8)),
+	}
+	for i, p := range pages {
+		for j := 0; j < len(p.Pix); j += 4 {
+			v := uint8(j*7 + i*31)
+			p.Pix[j], p.Pix[j+1], p.Pix[j+2], p.Pix[j+3] = v, v, v, 255-v
+		}
+	}
+	c := &Charset{
+		Image:   pages[0],
+		Pages:   pages,
+		Face:    "Test Sans",
+		Size:    12,
+		DPI:     72,
+		Mode:    mode,
+		Padding: 2,
+		VerticalMetrics: VerticalMetrics{
+			Ascent:     9,
+			Descent:    3,
+			LineHeight: 12,
+		},
+		Glyphs: map[rune]Glyph{
+			'A': {Rune: 'A', Page: 0, X: 1, Y: 2, Width: 7, Height: 9, Bearing: -1, Baseline: 9, Advance: 7},
+			'j': {Rune: 'j', Page: 0, X: 8, Y: 2, Width: 4, Height: 12, Bearing: -2, Baseline: 9, Advance: 4},
+			'é': {Rune: 'é', Page: 1, X: 0, Y: 0, Width: 6, Height: 8, Bearing: 0, Baseline: 8, Advance: 6},
+			' ': {Rune: ' ', Advance: 3},
+		},
+		Kerning: []Kerning{{First: 'A', Second: 'j', Amount: -1}},
+	}
+	if mode != ModeBitmap {
+		c.Spread = float64(c.Padding)
+	}
+	return c
+}
+
+func TestBMFontGolden(t *testing.T) {
+	for _, mode := range []Mode{ModeBitmap, ModeSDF} {
+		for _, format := range []BMFontFormat{BMFontText, BMFontXML, BMFontBinary} {
+			name := string(mode) + "-" + string(format)
+			t.Run(name, func(t *testing.T) {
+				c := testCharset(mode)
+				golden := filepath.Join("testdata", "bmfont", name, "atlas.fnt")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := c.SaveBMFont(golden, format); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				path := filepath.Join(t.TempDir(), "atlas.fnt")
+				if err := c.SaveBMFont(path, format); err != nil {
+					t.Fatal(err)
+				}
+				got, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("%s differs from %s, run with -update if intended:\n%s", path, golden, got)
+				}
+
+				loaded, err := LoadBMFont(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkBMFont(t, c, loaded)
+			})
+		}
+	}
+}
+
+// checkBMFont compares what survives a trip through BMFont
+func checkBMFont(t *testing.T, want, got *Charset) {
+	t.Helper()
+	if got.Face != want.Face || got.Size != want.Size || got.Padding != want.Padding {
+		t.Fatalf("loaded face %q size %f padding %d, want %q %f %d", got.Face, got.Size, got.Padding, want.Face, want.Size, want.Padding)
+	}
+	if got.Mode != want.Mode || got.Spread != want.Spread {
+		t.Fatalf("loaded mode %s spread %f, want %s %f", got.Mode, got.Spread, want.Mode, want.Spread)
+	}
+	if got.Ascent != want.Ascent || got.LineHeight != want.LineHeight {
+		t.Fatalf("loaded ascent %f line height %f, want %f %f", got.Ascent, got.LineHeight, want.Ascent, want.LineHeight)
+	}
+	if len(got.Glyphs) != len(want.Glyphs) {
+		t.Fatalf("loaded %d glyphs, want %d", len(got.Glyphs), len(want.Glyphs))
+	}
+	for r, g := range want.Glyphs {
+		if got.Glyphs[r] != g {
+			t.Fatalf("glyph %q loaded as %+v, want %+v", r, got.Glyphs[r], g)
+		}
+	}
+	if len(got.Kerning) != len(want.Kerning) || got.Kerning[0] != want.Kerning[0] {
+		t.Fatalf("loaded kerning %v, want %v", got.Kerning, want.Kerning)
+	}
+	if len(got.Pages) != len(want.Pages) {
+		t.Fatalf("loaded %d pages, want %d", len(got.Pages), len(want.Pages))
+	}
+	// Pages are padded to the largest one
+	for i, p := range want.Pages {
+		b := p.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if got.Pages[i].RGBAAt(x, y) != p.RGBAAt(x, y) {
+					t.Fatalf("page %d at %d,%d loaded as %v, want %v", i, x, y, got.Pages[i].RGBAAt(x, y), p.RGBAAt(x, y))
+				}
+			}
+		}
+	}
+}
+
+// Save and SaveBMFont write their pages apart, so exporting both keeps the
+// sidecar checksums valid
+func TestBMFontNextToSave(t *testing.T) {
+	c := testCharset(ModeBitmap)
+	dir := t.TempDir()
+	if err := c.Save(filepath.Join(dir, "atlas.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SaveBMFont(filepath.Join(dir, "atlas.fnt"), BMFontText); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCharset(filepath.Join(dir, "atlas.png")); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBMFont(filepath.Join(dir, "atlas.fnt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBMFont(t, c, loaded)
+}
+
+// The fixtures are laid out as BMFont 1.14 writes 8 bit textures, a grey png
+// of the glyphs, and as Hiero writes its white glyphs with alpha. Both hold A
+// and B with coverage ramping across them
+func TestBMFontTools(t *testing.T) {
+	for _, path := range []string{"bmfont-8bit/arial.fnt", "hiero/arial.fnt"} {
+		t.Run(filepath.Dir(path), func(t *testing.T) {
+			c, err := LoadBMFont(filepath.Join("testdata", "bmfont", path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Face != "Arial" || c.Size != 16 || c.Mode != ModeBitmap || c.LineHeight != 16 || c.Ascent != 13 {
+				t.Fatalf("loaded face %q size %f mode %s line height %f ascent %f", c.Face, c.Size, c.Mode, c.LineHeight, c.Ascent)
+			}
+			want := Glyph{Rune: 'A', X: 0, Y: 0, Width: 10, Height: 12, Bearing: -1, Baseline: 12, Advance: 9}
+			if len(c.Glyphs) != 3 || c.Glyphs['A'] != want {
+				t.Fatalf("loaded %d glyphs with A %+v, want %+v", len(c.Glyphs), c.Glyphs['A'], want)
+			}
+			if c.Kern('A', 'B') != -1 {
+				t.Fatalf("kerning AB is %f, want -1", c.Kern('A', 'B'))
+			}
+
+			page := c.Pages[0]
+			for _, g := range []Glyph{c.Glyphs['A'], c.Glyphs['B']} {
+				for y := 0; y < g.Height; y++ {
+					for x := 0; x < g.Width; x++ {
+						want := color.RGBA{255, 255, 255, uint8(40 + x*20 + y)}
+						if got := page.RGBAAt(g.X+x, g.Y+y); got != want {
+							t.Fatalf("%q at %d,%d loaded as %v, want %v", g.Rune, x, y, got, want)
+						}
+					}
+				}
+			}
+			if got := page.RGBAAt(11, 0); got.A != 0 {
+				t.Fatalf("space between glyphs loaded as %v", got)
+			}
+		})
+	}
+}
+
+func TestBMFontMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"binary version", "BMF\x02"},
+		{"binary truncated block", "BMF\x03\x01\x20\x00\x00\x00\x00"},
+		{"binary short info", "BMF\x03\x01\x02\x00\x00\x00\x00\x00"},
+		{"no pages", "info face=\"x\" size=12\ncommon lineHeight=12 base=9 pages=0\n"},
+		{"page out of range", "common pages=1\npage id=3 file=\"atlas.png\"\n"},
+		{"unknown distance field", "distanceField fieldType=foo distanceRange=4\npage id=0 file=\"atlas_bm.png\"\n"},
+		{"packed", "common pages=1 packed=1 alphaChnl=0 redChnl=0 greenChnl=0 blueChnl=0\npage id=0 file=\"atlas_bm.png\"\n"},
+	}
+	dir := t.TempDir()
+	c := testCharset(ModeBitmap)
+	if err := c.SaveBMFont(filepath.Join(dir, "atlas.fnt"), BMFontText); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "bad.fnt")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadBMFont(path); err == nil {
+				t.Fatal("malformed bmfont loaded")
+			}
+		})
+	}
+}
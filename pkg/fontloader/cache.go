@@ -0,0 +1,166 @@
+package fontloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cache keeps rendered atlases in a directory, keyed by a hash of the font
+// bytes and load options, so they are only rendered once. Entries for
+// changed fonts or options are never hit again and age out
+type Cache struct {
+	Dir string
+	// MaxBytes bounds the size of the directory, the least recently used
+	// atlases are removed first. 0 leaves it unbounded
+	MaxBytes int64
+}
+
+// Charset loads the atlas from the cache, rendering and storing it if it is
+// missing or damaged. Dynamic charsets change after loading and are always
+// rendered
+func (c *Cache) Charset(f *Font, opts LoadOptions) (*Charset, error) {
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	if opts.Dynamic {
+		return f.Charset(opts)
+	}
+
+	key, err := cacheKey(f, opts)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(c.Dir, key+".png")
+	if charset, err := LoadCharset(path); err == nil {
+		// The sidecar time is what Prune goes by
+		now := time.Now()
+		_ = os.Chtimes(MetricsPath(path), now, now)
+		return charset, nil
+	}
+
+	charset, err := f.Charset(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create cache dir \"%s\": %w", c.Dir, err)
+	}
+	if err := charset.Save(path); err != nil {
+		return nil, err
+	}
+	if err := c.Prune(); err != nil {
+		return nil, err
+	}
+	return charset, nil
+}
+
+// cacheKey hashes everything that changes the rendered atlas
+func cacheKey(f *Font, opts LoadOptions) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", MetricsVersion)
+	f.hash(h)
+
+	effects := opts.Effects
+	opts.Effects = nil
+	// Workers only changes how fast the same atlas is rendered
+	opts.Workers = 0
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("could not json encode options: %w", err)
+	}
+	h.Write(data)
+	for _, e := range effects {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return "", fmt.Errorf("could not json encode effect: %w", err)
+		}
+		fmt.Fprintf(h, "\n%T%s", e, data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (f *Font) hash(w io.Writer) {
+	fmt.Fprintf(w, "%d %d\n", len(f.data), f.index)
+	w.Write(f.data)
+	for _, fb := range f.fallbacks {
+		fb.hash(w)
+	}
+}
+
+// cacheEntry is the pages and sidecar of one atlas
+type cacheEntry struct {
+	files []string
+	size  int64
+	used  time.Time
+}
+
+// Prune removes the least recently used atlases until the directory is within
+// MaxBytes, always keeping the most recent one. Files not written by the
+// cache are left alone
+func (c *Cache) Prune() error {
+	if c.MaxBytes <= 0 {
+		return nil
+	}
+	infos, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return fmt.Errorf("could not read cache dir \"%s\": %w", c.Dir, err)
+	}
+
+	entries := map[string]*cacheEntry{}
+	for _, info := range infos {
+		name := info.Name()
+		ext := filepath.Ext(name)
+		if info.IsDir() || (ext != ".png" && ext != ".json") {
+			continue
+		}
+		key := strings.TrimSuffix(name, ext)
+		if i := strings.IndexByte(key, '_'); i >= 0 {
+			key = key[:i]
+		}
+		if _, err := hex.DecodeString(key); err != nil || len(key) != sha256.Size*2 {
+			continue
+		}
+		e, ok := entries[key]
+		if !ok {
+			e = &cacheEntry{}
+			entries[key] = e
+		}
+		e.files = append(e.files, filepath.Join(c.Dir, name))
+		e.size += info.Size()
+		// Entries without a sidecar were never completed and go first
+		if ext == ".json" {
+			e.used = info.ModTime()
+		}
+	}
+
+	sorted := make([]*cacheEntry, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].used.After(sorted[j].used)
+	})
+
+	var total int64
+	for i, e := range sorted {
+		total += e.size
+		if i == 0 || total <= c.MaxBytes {
+			continue
+		}
+		for _, file := range e.files {
+			if err := os.Remove(file); err != nil {
+				return fmt.Errorf("could not remove \"%s\": %w", file, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package fontloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// testCacheKey is the key of the options once defaults are filled in, as the
+// cache sees them
+func testCacheKey(t *testing.T, f *Font, opts LoadOptions) string {
+	t.Helper()
+	if err := opts.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	key, err := cacheKey(f, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestCacheKey(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	key := testCacheKey(t, f, LoadOptions{})
+
+	same := map[string]LoadOptions{
+		"defaults given": {Size: 16, DPI: 72},
+		"workers":        {Workers: 3},
+	}
+	for name, opts := range same {
+		if testCacheKey(t, f, opts) != key {
+			t.Fatalf("%s changed the key", name)
+		}
+	}
+
+	changed := map[string]*Font{
+		"font bytes": testKernFont(t),
+		"fallback":   f.WithFallback(parseTestFont(t, goregular.TTF)),
+	}
+	for name, other := range changed {
+		if testCacheKey(t, other, LoadOptions{}) == key {
+			t.Fatalf("%s kept the key", name)
+		}
+	}
+	options := map[string]LoadOptions{
+		"size":   {Size: 17},
+		"mode":   {Mode: ModeSDF, Padding: 4},
+		"text":   {Text: "abc"},
+		"effect": {Effects: []Effect{Outline{Width: 1}}},
+	}
+	for name, opts := range options {
+		if testCacheKey(t, f, opts) == key {
+			t.Fatalf("%s kept the key", name)
+		}
+	}
+	if testCacheKey(t, f, LoadOptions{Effects: []Effect{Outline{Width: 1}}}) == testCacheKey(t, f, LoadOptions{Effects: []Effect{Outline{Width: 2}}}) {
+		t.Fatal("effect settings kept the key")
+	}
+}
+
+func TestCacheDamaged(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	opts := LoadOptions{Text: "abc"}
+	cache := &Cache{Dir: t.TempDir()}
+	want, err := cache.Charset(f, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(cache.Dir, testCacheKey(t, f, opts)+".png")
+
+	damage := map[string]string{
+		"page":    path,
+		"sidecar": MetricsPath(path),
+	}
+	for name, file := range damage {
+		t.Run(name, func(t *testing.T) {
+			if err := ioutil.WriteFile(file, []byte("damaged"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := cache.Charset(f, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Glyphs) != len(want.Glyphs) {
+				t.Fatalf("got %d glyphs, want %d", len(got.Glyphs), len(want.Glyphs))
+			}
+			// The entry is rendered again and stored
+			if _, err := LoadCharset(path); err != nil {
+				t.Fatalf("damaged entry was not replaced: %v", err)
+			}
+		})
+	}
+}
+
+// dirSize is the size of the files in dir, other than those named in keep
+func dirSize(t *testing.T, dir string, keep ...string) int64 {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, info := range infos {
+		size += info.Size()
+	}
+	for _, name := range keep {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size -= info.Size()
+	}
+	return size
+}
+
+func TestCachePrune(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.png"), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Find the size of a single atlas to bound the cache at about two
+	unbounded := &Cache{Dir: t.TempDir()}
+	if _, err := unbounded.Charset(f, LoadOptions{Text: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	cache := &Cache{Dir: dir, MaxBytes: dirSize(t, unbounded.Dir)*5/2 + 100}
+
+	var keys []string
+	start := time.Now().Add(-time.Hour)
+	for i, text := range []string{"abc", "abd", "abe", "abf", "abg"} {
+		opts := LoadOptions{Text: text}
+		if _, err := cache.Charset(f, opts); err != nil {
+			t.Fatal(err)
+		}
+		key := testCacheKey(t, f, opts)
+		keys = append(keys, key)
+		// Space the entries out in time, the clock may be too coarse
+		used := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, key+".json"), used, used); err != nil {
+			t.Fatal(err)
+		}
+
+		if size := dirSize(t, dir, "notes.png"); size > cache.MaxBytes {
+			t.Fatalf("cache of %d bytes after %d atlases, bound is %d", size, i+1, cache.MaxBytes)
+		}
+	}
+
+	// The two most recent are kept, foreign files are left alone
+	for i, key := range keys {
+		_, err := os.Stat(filepath.Join(dir, key+".png"))
+		if kept := i >= len(keys)-2; kept != (err == nil) {
+			t.Fatalf("atlas %d kept %v, want %v", i, err == nil, kept)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.png")); err != nil {
+		t.Fatal("pruned a file not written by the cache")
+	}
+
+	// A hit makes an atlas the most recently used
+	if _, err := cache.Charset(f, LoadOptions{Text: "abf"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Charset(f, LoadOptions{Text: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{keys[3], keys[0]} {
+		if _, err := os.Stat(filepath.Join(dir, key+".png")); err != nil {
+			t.Fatalf("recently used atlas %d was pruned", i)
+		}
+	}
+
+	// The most recent atlas is kept even if it alone is over the bound
+	used := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, keys[0]+".json"), used, used); err != nil {
+		t.Fatal(err)
+	}
+	cache.MaxBytes = 1
+	if err := cache.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, keys[0]+".png")); err != nil {
+		t.Fatal("pruned the most recent atlas")
+	}
+	if _, err := os.Stat(filepath.Join(dir, keys[3]+".png")); err == nil {
+		t.Fatal("kept an atlas past the bound")
+	}
+}
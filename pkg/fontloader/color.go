@@ -0,0 +1,417 @@
+package fontloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+var errColorTable = errors.New("malformed color table")
+
+// colorTables are the color glyphs of a font, layered outlines from COLR
+// version 0 records colored by the first CPAL palette, and PNG bitmaps from
+// CBDT located by CBLC
+type colorTables struct {
+	layers  map[sfnt.GlyphIndex][]colorLayer
+	strikes []colorStrike
+}
+
+type colorLayer struct {
+	glyph sfnt.GlyphIndex
+	color color.NRGBA
+}
+
+// colorStrike is the bitmaps for one size, ppem pixels per em
+type colorStrike struct {
+	ppem    int
+	bitmaps map[sfnt.GlyphIndex]colorBitmap
+}
+
+// colorBitmap is a PNG and where its top left is relative to the pen, y up
+type colorBitmap struct {
+	bearingX, bearingY int
+	png                []byte
+}
+
+// fontTables finds the tables of face index in a font or collection
+func fontTables(data []byte, index int) (map[string][]byte, error) {
+	header := data
+	if len(data) >= 12 && string(data[:4]) == "ttcf" {
+		numFonts := int(binary.BigEndian.Uint32(data[8:]))
+		if index < 0 || index >= numFonts || len(data) < 16+index*4 {
+			return nil, fmt.Errorf("no face %d in font with %d faces", index, numFonts)
+		}
+		offset := binary.BigEndian.Uint32(data[12+index*4:])
+		if uint64(offset) > uint64(len(data)) {
+			return nil, errColorTable
+		}
+		header = data[offset:]
+	}
+	if len(header) < 12 {
+		return nil, errColorTable
+	}
+
+	// Table offsets are from the start of the file, collection or not
+	tables := map[string][]byte{}
+	numTables := int(binary.BigEndian.Uint16(header[4:]))
+	for i := 0; i < numTables; i++ {
+		if len(header) < 12+i*16+16 {
+			return nil, errColorTable
+		}
+		rec := header[12+i*16:]
+		offset, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: table \"%s\" out of bounds", errColorTable, rec[:4])
+		}
+		tables[string(rec[:4])] = data[offset : offset+length]
+	}
+	return tables, nil
+}
+
+// parseColorTables reads the color tables of face index, nil if it has none
+func parseColorTables(data []byte, index int) (*colorTables, error) {
+	tables, err := fontTables(data, index)
+	if err != nil {
+		return nil, err
+	}
+	return readColorTables(tables)
+}
+
+func readColorTables(tables map[string][]byte) (*colorTables, error) {
+	c := &colorTables{}
+	if colr, cpal := tables["COLR"], tables["CPAL"]; colr != nil && cpal != nil {
+		palette, err := readCPAL(cpal)
+		if err != nil {
+			return nil, err
+		}
+		if c.layers, err = readCOLR(colr, palette); err != nil {
+			return nil, err
+		}
+	}
+	if cblc, cbdt := tables["CBLC"], tables["CBDT"]; cblc != nil && cbdt != nil {
+		var err error
+		if c.strikes, err = readCBLC(cblc, cbdt); err != nil {
+			return nil, err
+		}
+	}
+	if c.layers == nil && c.strikes == nil {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// readCPAL returns the first palette
+func readCPAL(b []byte) ([]color.NRGBA, error) {
+	if len(b) < 14 {
+		return nil, fmt.Errorf("%w: short CPAL", errColorTable)
+	}
+	be := binary.BigEndian
+	numEntries := int(be.Uint16(b[2:]))
+	numRecords := int(be.Uint16(b[6:]))
+	recordsOffset := int(be.Uint32(b[8:]))
+	first := int(be.Uint16(b[12:]))
+	if first+numEntries > numRecords || recordsOffset+numRecords*4 > len(b) {
+		return nil, fmt.Errorf("%w: CPAL palette out of bounds", errColorTable)
+	}
+	palette := make([]color.NRGBA, numEntries)
+	for i := range palette {
+		rec := b[recordsOffset+(first+i)*4:]
+		palette[i] = color.NRGBA{B: rec[0], G: rec[1], R: rec[2], A: rec[3]}
+	}
+	return palette, nil
+}
+
+// readCOLR reads the version 0 base glyph and layer records, which version 1
+// fonts keep for renderers without paint graphs
+func readCOLR(b []byte, palette []color.NRGBA) (map[sfnt.GlyphIndex][]colorLayer, error) {
+	if len(b) < 14 {
+		return nil, fmt.Errorf("%w: short COLR", errColorTable)
+	}
+	be := binary.BigEndian
+	numBase := int(be.Uint16(b[2:]))
+	baseOffset := int(be.Uint32(b[4:]))
+	layerOffset := int(be.Uint32(b[8:]))
+	numLayers := int(be.Uint16(b[12:]))
+	if baseOffset+numBase*6 > len(b) || layerOffset+numLayers*4 > len(b) {
+		return nil, fmt.Errorf("%w: COLR records out of bounds", errColorTable)
+	}
+
+	layers := make(map[sfnt.GlyphIndex][]colorLayer, numBase)
+	for i := 0; i < numBase; i++ {
+		rec := b[baseOffset+i*6:]
+		base := sfnt.GlyphIndex(be.Uint16(rec))
+		first, n := int(be.Uint16(rec[2:])), int(be.Uint16(rec[4:]))
+		if first+n > numLayers {
+			return nil, fmt.Errorf("%w: COLR layers out of bounds", errColorTable)
+		}
+		for j := first; j < first+n; j++ {
+			lrec := b[layerOffset+j*4:]
+			// 0xFFFF is the text color, white as color glyphs are not tinted
+			c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			if p := int(be.Uint16(lrec[2:])); p != 0xFFFF {
+				if p >= len(palette) {
+					return nil, fmt.Errorf("%w: COLR palette index %d out of bounds", errColorTable, p)
+				}
+				c = palette[p]
+			}
+			layers[base] = append(layers[base], colorLayer{glyph: sfnt.GlyphIndex(be.Uint16(lrec)), color: c})
+		}
+	}
+	return layers, nil
+}
+
+// readCBLC reads the strikes and locates the PNG bitmaps of every glyph in
+// CBDT, image formats 17, 18 and 19
+func readCBLC(b, cbdt []byte) ([]colorStrike, error) {
+	be := binary.BigEndian
+	bad := func(what string) ([]colorStrike, error) {
+		return nil, fmt.Errorf("%w: %s", errColorTable, what)
+	}
+	if len(b) < 8 {
+		return bad("short CBLC")
+	}
+	numSizes := int(be.Uint32(b[4:]))
+	if 8+numSizes*48 > len(b) {
+		return bad("CBLC sizes out of bounds")
+	}
+
+	var strikes []colorStrike
+	for i := 0; i < numSizes; i++ {
+		size := b[8+i*48:]
+		arrayOffset := int(be.Uint32(size))
+		numSubtables := int(be.Uint32(size[8:]))
+		strike := colorStrike{
+			ppem:    int(size[45]),
+			bitmaps: map[sfnt.GlyphIndex]colorBitmap{},
+		}
+		if arrayOffset+numSubtables*8 > len(b) {
+			return bad("CBLC index subtables out of bounds")
+		}
+
+		for j := 0; j < numSubtables; j++ {
+			entry := b[arrayOffset+j*8:]
+			firstGlyph, lastGlyph := int(be.Uint16(entry)), int(be.Uint16(entry[2:]))
+			sub := arrayOffset + int(be.Uint32(entry[4:]))
+			if sub+8 > len(b) || lastGlyph < firstGlyph {
+				return bad("CBLC index subtable out of bounds")
+			}
+			indexFormat := be.Uint16(b[sub:])
+			imageFormat := be.Uint16(b[sub+2:])
+			imageOffset := int(be.Uint32(b[sub+4:]))
+			body := b[sub+8:]
+
+			// Every format boils down to a range of cbdt per glyph, and
+			// formats 2 and 5 share their metrics between all glyphs
+			var glyphs []int
+			var offsets []int
+			var shared []byte
+			switch indexFormat {
+			case 1, 3:
+				n := lastGlyph - firstGlyph + 2
+				width := 4
+				if indexFormat == 3 {
+					width = 2
+				}
+				if len(body) < n*width {
+					return bad("CBLC offsets out of bounds")
+				}
+				for k := 0; k < n; k++ {
+					if width == 4 {
+						offsets = append(offsets, int(be.Uint32(body[k*4:])))
+					} else {
+						offsets = append(offsets, int(be.Uint16(body[k*2:])))
+					}
+					glyphs = append(glyphs, firstGlyph+k)
+				}
+			case 2:
+				if len(body) < 12 {
+					return bad("CBLC metrics out of bounds")
+				}
+				imageSize := int(be.Uint32(body))
+				shared = body[4:12]
+				for g := firstGlyph; g <= lastGlyph+1; g++ {
+					glyphs = append(glyphs, g)
+					offsets = append(offsets, (g-firstGlyph)*imageSize)
+				}
+			case 4:
+				if len(body) < 4 {
+					return bad("CBLC glyph array out of bounds")
+				}
+				n := int(be.Uint32(body)) + 1
+				if len(body) < 4+n*4 {
+					return bad("CBLC glyph array out of bounds")
+				}
+				for k := 0; k < n; k++ {
+					glyphs = append(glyphs, int(be.Uint16(body[4+k*4:])))
+					offsets = append(offsets, int(be.Uint16(body[6+k*4:])))
+				}
+			case 5:
+				if len(body) < 16 {
+					return bad("CBLC glyph array out of bounds")
+				}
+				imageSize := int(be.Uint32(body))
+				shared = body[4:12]
+				n := int(be.Uint32(body[12:]))
+				if len(body) < 16+n*2 {
+					return bad("CBLC glyph array out of bounds")
+				}
+				for k := 0; k <= n; k++ {
+					if k < n {
+						glyphs = append(glyphs, int(be.Uint16(body[16+k*2:])))
+					} else {
+						glyphs = append(glyphs, 0)
+					}
+					offsets = append(offsets, k*imageSize)
+				}
+			default:
+				continue
+			}
+
+			for k := 0; k+1 < len(offsets); k++ {
+				start, end := imageOffset+offsets[k], imageOffset+offsets[k+1]
+				if end <= start {
+					continue
+				}
+				if end > len(cbdt) {
+					return bad("CBDT glyph out of bounds")
+				}
+				bm, ok := readColorBitmap(imageFormat, cbdt[start:end], shared)
+				if ok {
+					strike.bitmaps[sfnt.GlyphIndex(glyphs[k])] = bm
+				}
+			}
+		}
+		strikes = append(strikes, strike)
+	}
+	return strikes, nil
+}
+
+// readColorBitmap splits a CBDT glyph into its metrics and PNG, shared being
+// the big metrics from the index for format 19
+func readColorBitmap(format uint16, b, shared []byte) (colorBitmap, bool) {
+	be := binary.BigEndian
+	var metrics []byte
+	switch format {
+	case 17:
+		// Small metrics: height, width, bearingX, bearingY, advance
+		if len(b) < 9 {
+			return colorBitmap{}, false
+		}
+		metrics, b = b[:5], b[5:]
+	case 18:
+		// Big metrics: height, width, horizontal bearings and advance, then
+		// the vertical ones
+		if len(b) < 12 {
+			return colorBitmap{}, false
+		}
+		metrics, b = b[:8], b[8:]
+	case 19:
+		if len(b) < 4 || shared == nil {
+			return colorBitmap{}, false
+		}
+		metrics = shared
+	default:
+		return colorBitmap{}, false
+	}
+	n := int(be.Uint32(b))
+	if len(b) < 4+n {
+		return colorBitmap{}, false
+	}
+	return colorBitmap{
+		bearingX: int(int8(metrics[2])),
+		bearingY: int(int8(metrics[3])),
+		png:      b[4 : 4+n],
+	}, true
+}
+
+// draw renders a color glyph at scale, returning the image and where its top
+// left is relative to the pen, y down. Layered outlines are preferred over
+// bitmaps
+func (c *colorTables) draw(f *sfnt.Font, buf *sfnt.Buffer, scale fixed.Int26_6, x sfnt.GlyphIndex) (*image.NRGBA, image.Point, bool) {
+	if c == nil {
+		return nil, image.Point{}, false
+	}
+	if layers, ok := c.layers[x]; ok {
+		return c.drawLayers(f, buf, scale, layers)
+	}
+	return c.drawBitmap(scale, x)
+}
+
+func (c *colorTables) drawLayers(f *sfnt.Font, buf *sfnt.Buffer, scale fixed.Int26_6, layers []colorLayer) (*image.NRGBA, image.Point, bool) {
+	var raster vector.Rasterizer
+	rects := make([]image.Rectangle, len(layers))
+	masks := make([]*image.Alpha, len(layers))
+	var bounds image.Rectangle
+	for i, l := range layers {
+		dr, mask, ok := glyphMask(f, buf, &raster, scale, l.glyph, fixed.Point26_6{})
+		if !ok {
+			return nil, image.Point{}, false
+		}
+		rects[i], masks[i] = dr, mask
+		bounds = bounds.Union(dr)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for i, l := range layers {
+		for y := 0; y < rects[i].Dy(); y++ {
+			for x := 0; x < rects[i].Dx(); x++ {
+				a := masks[i].AlphaAt(x, y).A
+				if a == 0 {
+					continue
+				}
+				layer := l.color
+				layer.A = uint8((int(layer.A)*int(a) + 127) / 255)
+				px, py := rects[i].Min.X-bounds.Min.X+x, rects[i].Min.Y-bounds.Min.Y+y
+				img.SetNRGBA(px, py, over(layer, img.NRGBAAt(px, py)))
+			}
+		}
+	}
+	return img, bounds.Min, true
+}
+
+// drawBitmap scales the bitmap from the smallest strike at least as large as
+// scale, or the largest strike
+func (c *colorTables) drawBitmap(scale fixed.Int26_6, x sfnt.GlyphIndex) (*image.NRGBA, image.Point, bool) {
+	var best *colorStrike
+	for i := range c.strikes {
+		s := &c.strikes[i]
+		if _, ok := s.bitmaps[x]; !ok {
+			continue
+		}
+		if best == nil ||
+			(best.ppem < int(scale)/64 && s.ppem > best.ppem) ||
+			(s.ppem >= int(scale)/64 && s.ppem < best.ppem) {
+			best = s
+		}
+	}
+	if best == nil || best.ppem == 0 {
+		return nil, image.Point{}, false
+	}
+	bm := best.bitmaps[x]
+	src, err := png.Decode(bytes.NewReader(bm.png))
+	if err != nil {
+		return nil, image.Point{}, false
+	}
+
+	k := float64(scale) / 64 / float64(best.ppem)
+	b := src.Bounds()
+	w := int(math.Round(float64(b.Dx()) * k))
+	h := int(math.Round(float64(b.Dy()) * k))
+	if w == 0 || h == 0 {
+		return nil, image.Point{}, false
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(img, img.Bounds(), src, b, xdraw.Src, nil)
+	at := image.Pt(int(math.Round(float64(bm.bearingX)*k)), -int(math.Round(float64(bm.bearingY)*k)))
+	return img, at, true
+}
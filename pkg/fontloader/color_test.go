@@ -0,0 +1,435 @@
+package fontloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+type tableBuf struct {
+	bytes.Buffer
+}
+
+func (b *tableBuf) u8(v int)  { b.WriteByte(byte(v)) }
+func (b *tableBuf) u16(v int) { binary.Write(b, binary.BigEndian, uint16(v)) }
+func (b *tableBuf) u32(v int) { binary.Write(b, binary.BigEndian, uint32(v)) }
+
+// testCPAL has a single palette
+func testCPAL(colors ...color.NRGBA) []byte {
+	var b tableBuf
+	b.u16(0)
+	b.u16(len(colors))
+	b.u16(1)
+	b.u16(len(colors))
+	b.u32(14)
+	b.u16(0)
+	for _, c := range colors {
+		b.Write([]byte{c.B, c.G, c.R, c.A})
+	}
+	return b.Bytes()
+}
+
+// testCOLR gives base the layers, each a glyph and palette index
+func testCOLR(base int, layers ...[2]int) []byte {
+	var b tableBuf
+	b.u16(0)
+	b.u16(1)
+	b.u32(14)
+	b.u32(20)
+	b.u16(len(layers))
+	b.u16(base)
+	b.u16(0)
+	b.u16(len(layers))
+	for _, l := range layers {
+		b.u16(l[0])
+		b.u16(l[1])
+	}
+	return b.Bytes()
+}
+
+func testPNG() []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 5)
+	}
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.Bytes()
+}
+
+// testCBDT holds a single bitmap at offset 4 with bearings 2, 28. Format 19
+// keeps its metrics in CBLC
+func testCBDT(imageFormat int, data []byte) []byte {
+	var b tableBuf
+	b.u32(0x30000)
+	switch imageFormat {
+	case 17:
+		b.Write([]byte{8, 8, 2, 28, 9})
+	case 18:
+		b.Write([]byte{8, 8, 2, 28, 9, 0, 0, 0})
+	}
+	b.u32(len(data))
+	b.Write(data)
+	return b.Bytes()
+}
+
+// testCBLC locates the bitmap of testCBDT for glyph gid in a 32 ppem strike
+func testCBLC(gid, indexFormat, imageFormat, imageSize int) []byte {
+	var sub tableBuf
+	sub.u16(indexFormat)
+	sub.u16(imageFormat)
+	sub.u32(4)
+	bigMetrics := []byte{8, 8, 2, 28, 9, 0, 0, 0}
+	switch indexFormat {
+	case 1:
+		sub.u32(0)
+		sub.u32(imageSize)
+	case 2:
+		sub.u32(imageSize)
+		sub.Write(bigMetrics)
+	case 3:
+		sub.u16(0)
+		sub.u16(imageSize)
+	case 4:
+		sub.u32(1)
+		sub.u16(gid)
+		sub.u16(0)
+		sub.u16(0)
+		sub.u16(imageSize)
+	case 5:
+		sub.u32(imageSize)
+		sub.Write(bigMetrics)
+		sub.u32(1)
+		sub.u16(gid)
+	}
+
+	var b tableBuf
+	b.u32(0x30000)
+	b.u32(1)
+	b.u32(56)
+	b.u32(8 + sub.Len())
+	b.u32(1)
+	b.u32(0)
+	b.Write(make([]byte, 24))
+	b.u16(gid)
+	b.u16(gid)
+	b.u8(32)
+	b.u8(32)
+	b.u8(32)
+	b.u8(1)
+	b.u16(gid)
+	b.u16(gid)
+	b.u32(8)
+	b.Write(sub.Bytes())
+	return b.Bytes()
+}
+
+// patch returns a copy of b with a big endian value of size bytes at offset
+func patch(b []byte, offset, size, v int) []byte {
+	b = append([]byte{}, b...)
+	switch size {
+	case 1:
+		b[offset] = byte(v)
+	case 2:
+		binary.BigEndian.PutUint16(b[offset:], uint16(v))
+	case 4:
+		binary.BigEndian.PutUint32(b[offset:], uint32(v))
+	}
+	return b
+}
+
+func TestReadCOLR(t *testing.T) {
+	palette := []color.NRGBA{{255, 0, 0, 255}, {0, 0, 255, 200}}
+	cpal := testCPAL(palette...)
+	colr := testCOLR(7, [2]int{3, 0}, [2]int{4, 0xFFFF}, [2]int{5, 1})
+
+	p, err := readCPAL(cpal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 2 || p[0] != palette[0] || p[1] != palette[1] {
+		t.Fatalf("palette %v, want %v", p, palette)
+	}
+	layers, err := readCOLR(colr, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []colorLayer{
+		{glyph: 3, color: palette[0]},
+		{glyph: 4, color: color.NRGBA{255, 255, 255, 255}},
+		{glyph: 5, color: palette[1]},
+	}
+	if len(layers) != 1 || len(layers[7]) != len(want) {
+		t.Fatalf("layers %v, want %v for glyph 7", layers, want)
+	}
+	for i, l := range layers[7] {
+		if l != want[i] {
+			t.Fatalf("layer %d is %v, want %v", i, l, want[i])
+		}
+	}
+
+	for n := 0; n < len(cpal); n++ {
+		if _, err := readCPAL(cpal[:n]); err == nil {
+			t.Fatalf("CPAL truncated to %d bytes parsed", n)
+		}
+	}
+	for n := 0; n < len(colr); n++ {
+		if _, err := readCOLR(colr[:n], p); err == nil {
+			t.Fatalf("COLR truncated to %d bytes parsed", n)
+		}
+	}
+
+	tests := []struct {
+		name string
+		cpal []byte
+		colr []byte
+	}{
+		{"cpal entries past records", patch(cpal, 2, 2, 3), colr},
+		{"cpal first entry past records", patch(cpal, 12, 2, 1), colr},
+		{"cpal records offset", patch(cpal, 8, 4, 0xFFFFFFF0), colr},
+		{"colr base offset", cpal, patch(colr, 4, 4, 0xFFFFFFF0)},
+		{"colr base count", cpal, patch(colr, 2, 2, 40)},
+		{"colr layer offset", cpal, patch(colr, 8, 4, 1000)},
+		{"colr layer count", cpal, patch(colr, 12, 2, 1000)},
+		{"colr first layer", cpal, patch(colr, 16, 2, 2)},
+		{"colr layers of base", cpal, patch(colr, 18, 2, 4)},
+		{"colr palette index", cpal, patch(colr, 30, 2, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := readCPAL(tt.cpal)
+			if err == nil {
+				_, err = readCOLR(tt.colr, p)
+			}
+			if err == nil {
+				t.Fatal("out of range offsets parsed")
+			}
+		})
+	}
+}
+
+func TestReadCBLC(t *testing.T) {
+	pngData := testPNG()
+	formats := []struct {
+		index, image int
+	}{
+		{1, 17}, {3, 17}, {4, 18}, {2, 19}, {5, 19},
+	}
+	for _, f := range formats {
+		cbdt := testCBDT(f.image, pngData)
+		cblc := testCBLC(9, f.index, f.image, len(cbdt)-4)
+		strikes, err := readCBLC(cblc, cbdt)
+		if err != nil {
+			t.Fatalf("index format %d image format %d: %v", f.index, f.image, err)
+		}
+		if len(strikes) != 1 || strikes[0].ppem != 32 {
+			t.Fatalf("index format %d image format %d: strikes %v", f.index, f.image, strikes)
+		}
+		bm, ok := strikes[0].bitmaps[9]
+		if !ok || bm.bearingX != 2 || bm.bearingY != 28 || !bytes.Equal(bm.png, pngData) {
+			t.Fatalf("index format %d image format %d: bitmap %v %d,%d", f.index, f.image, ok, bm.bearingX, bm.bearingY)
+		}
+
+		for n := 0; n < len(cblc); n++ {
+			if _, err := readCBLC(cblc[:n], cbdt); err == nil {
+				t.Fatalf("index format %d: CBLC truncated to %d bytes parsed", f.index, n)
+			}
+		}
+		for n := 0; n < len(cbdt); n++ {
+			if _, err := readCBLC(cblc, cbdt[:n]); err == nil {
+				t.Fatalf("index format %d: CBDT truncated to %d bytes parsed", f.index, n)
+			}
+		}
+	}
+
+	cbdt := testCBDT(17, pngData)
+	format1 := testCBLC(9, 1, 17, len(cbdt)-4)
+	format4 := testCBLC(9, 4, 18, len(cbdt)-4)
+	format5 := testCBLC(9, 5, 19, len(cbdt)-4)
+	tests := []struct {
+		name string
+		cblc []byte
+	}{
+		{"sizes", patch(format1, 4, 4, 1000)},
+		{"subtable array offset", patch(format1, 8, 4, 5000)},
+		{"subtable count", patch(format1, 16, 4, 100)},
+		{"subtable offset", patch(format1, 60, 4, 5000)},
+		{"last before first glyph", patch(format1, 56, 2, 10)},
+		{"last glyph past offsets", patch(format1, 58, 2, 12)},
+		{"image offset", patch(format1, 68, 4, 0xFFFFF0)},
+		{"glyph end", patch(format1, 76, 4, len(cbdt))},
+		{"glyph array count", patch(format4, 72, 4, 1000)},
+		{"glyph array offset", patch(format4, 82, 2, 5000)},
+		{"shared glyph count", patch(format5, 84, 4, 1000)},
+		{"shared image size", patch(format5, 72, 4, 5000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readCBLC(tt.cblc, cbdt); err == nil {
+				t.Fatal("out of range offsets parsed")
+			}
+		})
+	}
+
+	// Unknown formats are skipped rather than failing the font
+	strikes, err := readCBLC(patch(format1, 66, 2, 20), cbdt)
+	if err != nil || len(strikes[0].bitmaps) != 0 {
+		t.Fatalf("unknown image format gave %v, %v", strikes, err)
+	}
+}
+
+// withTables rebuilds a font with tables added or replaced
+func withTables(t *testing.T, data []byte, extra map[string][]byte) []byte {
+	t.Helper()
+	tables, err := fontTables(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tag, table := range extra {
+		tables[tag] = table
+	}
+	var tags []string
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var dir, body tableBuf
+	dir.Write(data[:4])
+	dir.u16(len(tags))
+	dir.u16(16)
+	dir.u16(4)
+	dir.u16(len(tags)*16 - 256)
+	offset := 12 + 16*len(tags)
+	for _, tag := range tags {
+		dir.WriteString(tag)
+		dir.u32(0)
+		dir.u32(offset + body.Len())
+		dir.u32(len(tables[tag]))
+		body.Write(tables[tag])
+		for body.Len()%4 != 0 {
+			body.u8(0)
+		}
+	}
+	return append(dir.Bytes(), body.Bytes()...)
+}
+
+// testColorFont is pragmono with A drawn as a red O over a blue I, and B as
+// a bitmap
+func testColorFont(t *testing.T) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile("../../pragmono.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf sfnt.Buffer
+	gid := func(r rune) int {
+		g, err := f.GlyphIndex(&buf, r)
+		if err != nil || g == 0 {
+			t.Fatalf("no glyph for %q", r)
+		}
+		return int(g)
+	}
+	cbdt := testCBDT(17, testPNG())
+	return withTables(t, data, map[string][]byte{
+		"CPAL": testCPAL(color.NRGBA{255, 0, 0, 160}, color.NRGBA{0, 0, 255, 255}),
+		"COLR": testCOLR(gid('A'), [2]int{gid('I'), 1}, [2]int{gid('O'), 0}),
+		"CBDT": cbdt,
+		"CBLC": testCBLC(gid('B'), 1, 17, len(cbdt)-4),
+	})
+}
+
+func TestColorGlyphs(t *testing.T) {
+	f, err := ParseFont(testColorFont(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := f.Charset(LoadOptions{Size: 24, Text: "ABC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r, want := range map[rune]bool{'A': true, 'B': true, 'C': false} {
+		if g := c.Glyphs[r]; g.Color != want {
+			t.Fatalf("glyph %q color %v, want %v", r, g.Color, want)
+		}
+	}
+	// Translucent layer colors survive saving untinted
+	roundTrip(t, c)
+}
+
+func TestBrokenColorTables(t *testing.T) {
+	data, err := ioutil.ReadFile("../../pragmono.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := withTables(t, data, map[string][]byte{
+		"CPAL": testCPAL(color.NRGBA{255, 0, 0, 255}),
+		"COLR": patch(testCOLR(36, [2]int{37, 0}), 8, 4, 1000),
+	})
+	f, err := ParseFont(broken)
+	if err != nil {
+		t.Fatalf("broken color tables failed the font: %v", err)
+	}
+	c, err := f.Charset(LoadOptions{Text: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, ok := c.Glyphs['A']; !ok || g.Color || g.Width == 0 {
+		t.Fatalf("glyph A is %+v, want its outline", g)
+	}
+}
+
+func TestFontTables(t *testing.T) {
+	data, err := ioutil.ReadFile("../../pragmono.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := fontTables(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tables["glyf"]; !ok {
+		t.Fatal("no glyf table")
+	}
+
+	var ttc tableBuf
+	ttc.WriteString("ttcf")
+	ttc.u32(0x10000)
+	ttc.u32(1)
+	ttc.u32(16)
+	ttc.Write(data)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		index int
+	}{
+		{"short header", data[:11], 0},
+		{"short directory", data[:20], 0},
+		{"table past end", data[:len(data)/2], 0},
+		{"table offset", patch(data, 12+8, 4, 0xFFFFFFF0), 0},
+		{"collection index", ttc.Bytes(), 1},
+		{"collection offset", patch(ttc.Bytes(), 12, 4, len(ttc.Bytes())+1), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fontTables(tt.data, tt.index); err == nil {
+				t.Fatal("malformed font parsed")
+			}
+		})
+	}
+	if tables, err := fontTables(ttc.Bytes(), 0); err != nil || tables["glyf"] == nil {
+		t.Fatalf("collection face gave %v", err)
+	}
+}
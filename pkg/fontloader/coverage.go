@@ -0,0 +1,88 @@
+package fontloader
+
+import (
+	"unicode"
+)
+
+//go:generate go run ../../internal/gen/blocks -out blocks.go
+
+// unicodeBlock is a named range of runes, see blocks.go
+type unicodeBlock struct {
+	name        string
+	first, last rune
+}
+
+// BlockCoverage is how much of a Unicode block a font has glyphs for. Only
+// the runes worth having a glyph for, graphic, format and private use ones,
+// are counted
+type BlockCoverage struct {
+	Name    string `json:"name"`
+	First   rune   `json:"first"`
+	Last    rune   `json:"last"`
+	Covered int    `json:"covered"`
+	Total   int    `json:"total"`
+}
+
+// Coverage describes which runes a font has glyphs for
+type Coverage struct {
+	// Glyphs is the number of glyphs in the font, including those not mapped
+	// to a rune
+	Glyphs int `json:"glyphs"`
+	// Runes is the number of runes with a glyph
+	Runes int `json:"runes"`
+	// Blocks lists the blocks with at least one rune covered
+	Blocks []BlockCoverage `json:"blocks"`
+	// Ranges are the runs of runes with a glyph
+	Ranges []RuneRange `json:"ranges"`
+}
+
+// Coverage walks every Unicode block for the runes the font, and its
+// fallbacks, has glyphs for
+func (f *Font) Coverage() Coverage {
+	c := Coverage{Glyphs: f.src.glyphs()}
+	var run *RuneRange
+	for _, b := range unicodeBlocks {
+		block := BlockCoverage{Name: b.name, First: b.first, Last: b.last}
+		for r := b.first; r <= b.last; r++ {
+			counted := unicode.IsGraphic(r) || unicode.In(r, unicode.Cf, unicode.Co)
+			if counted {
+				block.Total++
+			}
+			if f.src.index(r) == 0 {
+				continue
+			}
+			c.Runes++
+			if counted {
+				block.Covered++
+			}
+			if run != nil && run.Last == r-1 {
+				run.Last = r
+			} else {
+				c.Ranges = append(c.Ranges, RuneRange{First: r, Last: r})
+				run = &c.Ranges[len(c.Ranges)-1]
+			}
+		}
+		if block.Covered > 0 {
+			c.Blocks = append(c.Blocks, block)
+		}
+	}
+	return c
+}
+
+// Missing returns the runes of text the font has no glyph for, once each in
+// the order they appear. Control characters and other runes that are never
+// drawn are left out
+func (f *Font) Missing(text string) []rune {
+	seen := map[rune]bool{}
+	var missing []rune
+	for _, r := range text {
+		if seen[r] || !unicode.IsGraphic(r) {
+			continue
+		}
+		seen[r] = true
+		if f.src.index(r) == 0 {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,53 @@
+package fontloader
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestCoverage(t *testing.T) {
+	f := loadTestFont(t, "testdata/CFFTest.otf")
+	c := f.Coverage()
+	// CFFTest has glyphs for 0, 1, Q and 中 besides .notdef
+	if c.Glyphs != 5 || c.Runes != 4 {
+		t.Fatalf("%d glyphs for %d runes, want 5 for 4", c.Glyphs, c.Runes)
+	}
+	ranges := []RuneRange{{'0', '1'}, {'Q', 'Q'}, {'中', '中'}}
+	if !reflect.DeepEqual(c.Ranges, ranges) {
+		t.Fatalf("ranges %v, want %v", c.Ranges, ranges)
+	}
+	if len(c.Blocks) != 2 {
+		t.Fatalf("blocks %+v, want Basic Latin and CJK", c.Blocks)
+	}
+	// Only the printable ASCII is counted
+	if b := c.Blocks[0]; b.Name != "Basic Latin" || b.Covered != 3 || b.Total != 95 {
+		t.Fatalf("block %+v, want 3 of 95 Basic Latin", b)
+	}
+	if b := c.Blocks[1]; b.Name != "CJK Unified Ideographs" || b.Covered != 1 {
+		t.Fatalf("block %+v, want 1 CJK Unified Ideograph", b)
+	}
+
+	// Fallbacks add their glyphs
+	regular := parseTestFont(t, goregular.TTF)
+	chain := f.WithFallback(regular).Coverage()
+	if own := regular.Coverage(); chain.Glyphs != c.Glyphs+own.Glyphs || chain.Runes != own.Runes+1 {
+		t.Fatalf("chain has %d glyphs for %d runes, want %d for %d", chain.Glyphs, chain.Runes, c.Glyphs+own.Glyphs, own.Runes+1)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	f := loadTestFont(t, "testdata/CFFTest.otf")
+	// Repeats are listed once, control characters never
+	missing := f.Missing("Q0x\n中Qx日\t")
+	if want := []rune{'x', '日'}; !reflect.DeepEqual(missing, want) {
+		t.Fatalf("missing %q, want %q", missing, want)
+	}
+	if missing := f.Missing("10Q中"); len(missing) != 0 {
+		t.Fatalf("missing %q of covered runes", missing)
+	}
+	if missing := f.WithFallback(parseTestFont(t, goregular.TTF)).Missing("Q0x\n中Qx日"); !reflect.DeepEqual(missing, []rune{'日'}) {
+		t.Fatalf("chain missing %q, want only 日", missing)
+	}
+}
@@ -0,0 +1,129 @@
+package fontloader
+
+import (
+	"image"
+	"image/draw"
+	"unicode"
+
+	"github.com/perlw/sandbox_go/pkg/packer"
+)
+
+// dynamic is what a charset needs to render more glyphs after loading
+type dynamic struct {
+	rast       *rasterizer
+	pack       *packer.Packer
+	generation int
+}
+
+// Generation is bumped every time glyphs are added to the atlas, compare it
+// to know when the pages need to be uploaded again
+func (c *Charset) Generation() int {
+	if c.dynamic == nil {
+		return 0
+	}
+	return c.dynamic.generation
+}
+
+// Require makes sure every rune in the text is in the atlas and returns the
+// ones the font cannot provide
+func (c *Charset) Require(text string) []rune {
+	var missing []rune
+	for _, r := range text {
+		if _, ok := c.Glyph(r); !ok {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// addMissing remembers a rune can not be rendered, only runes that are ever
+// drawn are listed as missing
+func (c *Charset) addMissing(r rune) {
+	if c.missing == nil {
+		c.missing = map[rune]bool{}
+	}
+	if !c.missing[r] {
+		c.missing[r] = true
+		if unicode.IsGraphic(r) {
+			c.Missing = append(c.Missing, r)
+		}
+	}
+}
+
+// add renders and packs a single rune
+func (c *Charset) add(r rune) (Glyph, bool) {
+	d := c.dynamic
+	if c.missing[r] {
+		return Glyph{}, false
+	}
+	src := d.rast.src
+	if src.index(r) == 0 {
+		c.addMissing(r)
+		return Glyph{}, false
+	}
+
+	img, g, err := d.rast.render(r)
+	if err != nil {
+		c.addMissing(r)
+		return Glyph{}, false
+	}
+	rect, err := d.pack.Pack(g.Width, g.Height)
+	if err != nil {
+		c.addMissing(r)
+		return Glyph{}, false
+	}
+	c.resize(d.pack)
+	c.draw(img, &g, rect)
+	if c.MipLevels > 0 {
+		c.mipmap(rect.Page)
+	}
+
+	if src.hasKern() {
+		right := src.index(r)
+		pairs := func(first, second rune, kern float64) {
+			if kern != 0 {
+				c.Kerning = append(c.Kerning, Kerning{First: first, Second: second, Amount: kern})
+			}
+		}
+		pairs(r, r, float64(src.kern(d.rast.scale, right, right))/64)
+		// r is already among the glyphs, its pair with itself is added once
+		for other := range c.Glyphs {
+			if other == r {
+				continue
+			}
+			left := src.index(other)
+			pairs(other, r, float64(src.kern(d.rast.scale, left, right))/64)
+			pairs(r, other, float64(src.kern(d.rast.scale, right, left))/64)
+		}
+		c.kerning = nil
+	}
+
+	c.Glyphs[r] = g
+	d.generation++
+	return g, true
+}
+
+// resize makes the pages match the packer, keeping what is already drawn
+func (c *Charset) resize(pack *packer.Packer) {
+	for i := 0; i < pack.Pages(); i++ {
+		w, h := pack.PageSize(i)
+		if i == len(c.Pages) {
+			c.Pages = append(c.Pages, image.NewRGBA(image.Rect(0, 0, w, h)))
+			continue
+		}
+		if old := c.Pages[i]; old.Bounds().Dx() != w || old.Bounds().Dy() != h {
+			c.Pages[i] = image.NewRGBA(image.Rect(0, 0, w, h))
+			draw.Draw(c.Pages[i], old.Bounds(), old, image.ZP, draw.Src)
+		}
+	}
+	c.Image = c.Pages[0]
+}
+
+// draw copies a rendered glyph to where it was packed and records it
+func (c *Charset) draw(img *image.RGBA, g *Glyph, rect packer.Rect) {
+	g.Page, g.X, g.Y = rect.Page, rect.X, rect.Y
+	if img != nil {
+		draw.Draw(c.Pages[g.Page], image.Rect(g.X, g.Y, g.X+g.Width, g.Y+g.Height), img, image.ZP, draw.Src)
+	}
+	c.Glyphs[g.Rune] = *g
+}
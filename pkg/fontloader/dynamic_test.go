@@ -0,0 +1,112 @@
+package fontloader
+
+import (
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// testKern is a format 0 kern table of left, right and value triples
+func testKern(pairs [][3]int) []byte {
+	pairs = append([][3]int{}, pairs...)
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i][0]<<16|pairs[i][1] < pairs[j][0]<<16|pairs[j][1]
+	})
+	var b tableBuf
+	b.u16(0)
+	b.u16(1)
+	b.u16(0)
+	b.u16(14 + 6*len(pairs))
+	b.u16(1)
+	b.u16(len(pairs))
+	b.u16(0)
+	b.u16(0)
+	b.u16(0)
+	for _, p := range pairs {
+		b.u16(p[0])
+		b.u16(p[1])
+		b.u16(p[2])
+	}
+	return b.Bytes()
+}
+
+// testKernFont is pragmono with the pairs AA, AV and VA kerned
+func testKernFont(t *testing.T) *Font {
+	t.Helper()
+	data, err := ioutil.ReadFile("../../pragmono.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf sfnt.Buffer
+	a, _ := sf.GlyphIndex(&buf, 'A')
+	v, _ := sf.GlyphIndex(&buf, 'V')
+	kern := testKern([][3]int{
+		{int(a), int(a), -100},
+		{int(a), int(v), -200},
+		{int(v), int(a), -300},
+	})
+	f, err := ParseFont(withTables(t, data, map[string][]byte{"kern": kern}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestDynamic(t *testing.T) {
+	f := testKernFont(t)
+	c, err := f.Charset(LoadOptions{Text: "x", Dynamic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generation := c.Generation()
+	if missing := c.Require("VAAVx"); len(missing) != 0 {
+		t.Fatalf("missing %q", missing)
+	}
+	if c.Generation() != generation+2 {
+		t.Fatalf("generation %d after adding 2 glyphs to %d", c.Generation(), generation)
+	}
+	for _, r := range "AVx" {
+		if _, ok := c.Glyphs[r]; !ok {
+			t.Fatalf("no glyph for %q", r)
+		}
+	}
+
+	// Each pair is listed once, as if the runes were rendered up front
+	seen := map[[2]rune]bool{}
+	for _, k := range c.Kerning {
+		key := [2]rune{k.First, k.Second}
+		if seen[key] {
+			t.Fatalf("kerning %q listed twice in %v", string(key[:]), c.Kerning)
+		}
+		seen[key] = true
+	}
+	static, err := f.Charset(LoadOptions{Text: "AVx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(static.Kerning) != 3 || len(c.Kerning) != len(static.Kerning) {
+		t.Fatalf("kerning %v, want %v", c.Kerning, static.Kerning)
+	}
+	for _, k := range static.Kerning {
+		if got := c.Kern(k.First, k.Second); got != k.Amount {
+			t.Fatalf("kerning %q%q is %f, want %f", k.First, k.Second, got, k.Amount)
+		}
+	}
+
+	// Runes without a glyph are reported, but only those ever drawn listed
+	if missing := c.Require("\U0001D11E\x07"); len(missing) != 2 {
+		t.Fatalf("missing %q, want both runes", missing)
+	}
+	if len(c.Missing) != 1 || c.Missing[0] != '\U0001D11E' {
+		t.Fatalf("listed missing %q, want only U+1D11E", c.Missing)
+	}
+	if c.Generation() != generation+2 {
+		t.Fatal("missing runes bumped the generation")
+	}
+}
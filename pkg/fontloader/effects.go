@@ -0,0 +1,307 @@
+package fontloader
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Effect changes how a glyph looks in bitmap mode. Effects are applied in
+// order, each to the result of the previous ones, starting from the glyph
+// filled in white
+type Effect interface {
+	// margins is how far the effect reaches outside of what it is applied
+	// to, left, top, right and bottom
+	margins() [4]int
+	apply(canvas *image.NRGBA, coverage *image.Gray)
+}
+
+// Outline draws a band of Width pixels around everything so far, behind it
+type Outline struct {
+	Width float64     `json:"width"`
+	Color color.NRGBA `json:"color"`
+}
+
+// DropShadow draws an offset and blurred copy of everything so far, behind
+// it. Blur is the radius in pixels
+type DropShadow struct {
+	OffsetX int         `json:"offsetX"`
+	OffsetY int         `json:"offsetY"`
+	Blur    float64     `json:"blur"`
+	Color   color.NRGBA `json:"color"`
+}
+
+// InnerGlow lights the glyph from its edges inwards, fading out at Radius
+// pixels
+type InnerGlow struct {
+	Radius float64     `json:"radius"`
+	Color  color.NRGBA `json:"color"`
+}
+
+// Gradient fills the glyph from Top at the top of its ink to Bottom at the
+// bottom
+type Gradient struct {
+	Top    color.NRGBA `json:"top"`
+	Bottom color.NRGBA `json:"bottom"`
+}
+
+// effectMargins sums the margins of all effects
+func effectMargins(effects []Effect) [4]int {
+	var total [4]int
+	for _, e := range effects {
+		m := e.margins()
+		for i := range total {
+			total[i] += m[i]
+		}
+	}
+	return total
+}
+
+// over composites top over bottom, both with straight alpha
+func over(top, bottom color.NRGBA) color.NRGBA {
+	ta := float64(top.A) / 255
+	ba := float64(bottom.A) / 255
+	a := ta + ba*(1-ta)
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	mix := func(t, b uint8) uint8 {
+		return uint8(math.Round((float64(t)*ta + float64(b)*ba*(1-ta)) / a))
+	}
+	return color.NRGBA{
+		R: mix(top.R, bottom.R),
+		G: mix(top.G, bottom.G),
+		B: mix(top.B, bottom.B),
+		A: uint8(math.Round(a * 255)),
+	}
+}
+
+// behind draws c with the alpha of mask under the canvas
+func behind(canvas *image.NRGBA, mask []float64, c color.NRGBA) {
+	b := canvas.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			m := mask[y*b.Dx()+x]
+			if m <= 0 {
+				continue
+			}
+			layer := c
+			layer.A = uint8(math.Round(float64(c.A) * math.Min(m, 1)))
+			canvas.SetNRGBA(x, y, over(canvas.NRGBAAt(x, y), layer))
+		}
+	}
+}
+
+// alphas returns the canvas alpha as 0-1
+func alphas(canvas *image.NRGBA) []float64 {
+	b := canvas.Bounds()
+	a := make([]float64, b.Dx()*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			a[y*b.Dx()+x] = float64(canvas.NRGBAAt(x, y).A) / 255
+		}
+	}
+	return a
+}
+
+func (e Outline) margins() [4]int {
+	m := int(math.Ceil(e.Width))
+	return [4]int{m, m, m, m}
+}
+
+func (e Outline) apply(canvas *image.NRGBA, coverage *image.Gray) {
+	if e.Width <= 0 {
+		return
+	}
+	b := canvas.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := alphas(canvas)
+	mask := make([]float64, len(src))
+	r := int(math.Ceil(e.Width)) + 1
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var best float64
+			for dy := -r; dy <= r; dy++ {
+				for dx := -r; dx <= r; dx++ {
+					sx, sy := x+dx, y+dy
+					if sx < 0 || sy < 0 || sx >= w || sy >= h {
+						continue
+					}
+					a := src[sy*w+sx]
+					if a <= best {
+						continue
+					}
+					// Fade over the last pixel to keep the band smooth
+					reach := e.Width + 0.5 - math.Hypot(float64(dx), float64(dy))
+					if v := a * math.Max(0, math.Min(1, reach)); v > best {
+						best = v
+					}
+				}
+			}
+			mask[y*w+x] = best
+		}
+	}
+	behind(canvas, mask, e.Color)
+}
+
+func (e DropShadow) margins() [4]int {
+	r := int(math.Ceil(e.Blur))
+	positive := func(v int) int {
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	return [4]int{
+		positive(r - e.OffsetX),
+		positive(r - e.OffsetY),
+		positive(r + e.OffsetX),
+		positive(r + e.OffsetY),
+	}
+}
+
+func (e DropShadow) apply(canvas *image.NRGBA, coverage *image.Gray) {
+	b := canvas.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := alphas(canvas)
+	mask := make([]float64, len(src))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := x-e.OffsetX, y-e.OffsetY
+			if sx >= 0 && sy >= 0 && sx < w && sy < h {
+				mask[y*w+x] = src[sy*w+sx]
+			}
+		}
+	}
+	if e.Blur > 0 {
+		mask = blur(mask, w, h, e.Blur)
+	}
+	behind(canvas, mask, e.Color)
+}
+
+// blur is a separable gaussian blur, radius being three standard deviations
+func blur(src []float64, w, h int, radius float64) []float64 {
+	r := int(math.Ceil(radius))
+	sigma := radius / 3
+	kernel := make([]float64, r*2+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - r)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	pass := func(src []float64, dx, dy int) []float64 {
+		dst := make([]float64, len(src))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				var v float64
+				for i, k := range kernel {
+					sx, sy := x+(i-r)*dx, y+(i-r)*dy
+					if sx < 0 || sy < 0 || sx >= w || sy >= h {
+						continue
+					}
+					v += src[sy*w+sx] * k
+				}
+				dst[y*w+x] = v
+			}
+		}
+		return dst
+	}
+	return pass(pass(src, 1, 0), 0, 1)
+}
+
+func (e InnerGlow) margins() [4]int {
+	return [4]int{}
+}
+
+func (e InnerGlow) apply(canvas *image.NRGBA, coverage *image.Gray) {
+	if e.Radius <= 0 {
+		return
+	}
+	b := coverage.Bounds()
+	w, h := b.Dx(), b.Dy()
+	outside := func(x, y int) bool {
+		return x < 0 || y < 0 || x >= w || y >= h || coverage.GrayAt(x, y).Y < 128
+	}
+	r := int(math.Ceil(e.Radius))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			cov := coverage.GrayAt(x, y).Y
+			if cov == 0 {
+				continue
+			}
+			nearest := e.Radius
+			for dy := -r; dy <= r; dy++ {
+				for dx := -r; dx <= r; dx++ {
+					if d := math.Hypot(float64(dx), float64(dy)); d < nearest && outside(x+dx, y+dy) {
+						nearest = d
+					}
+				}
+			}
+			strength := 1 - nearest/e.Radius
+			if strength <= 0 {
+				continue
+			}
+			layer := e.Color
+			layer.A = uint8(math.Round(float64(e.Color.A) * strength * float64(cov) / 255))
+			canvas.SetNRGBA(x, y, over(layer, canvas.NRGBAAt(x, y)))
+		}
+	}
+}
+
+func (e Gradient) margins() [4]int {
+	return [4]int{}
+}
+
+func (e Gradient) apply(canvas *image.NRGBA, coverage *image.Gray) {
+	b := coverage.Bounds()
+	top, bottom := -1, -1
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if coverage.GrayAt(x, y).Y > 0 {
+				if top < 0 {
+					top = y
+				}
+				bottom = y
+				break
+			}
+		}
+	}
+	if top < 0 {
+		return
+	}
+
+	lerp := func(a, b uint8, t float64) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+	for y := top; y <= bottom; y++ {
+		t := 0.0
+		if bottom > top {
+			t = float64(y-top) / float64(bottom-top)
+		}
+		fill := color.NRGBA{
+			R: lerp(e.Top.R, e.Bottom.R, t),
+			G: lerp(e.Top.G, e.Bottom.G, t),
+			B: lerp(e.Top.B, e.Bottom.B, t),
+			A: lerp(e.Top.A, e.Bottom.A, t),
+		}
+		for x := 0; x < b.Dx(); x++ {
+			cov := coverage.GrayAt(x, y).Y
+			if cov == 0 {
+				continue
+			}
+			// Recolor the fill only, keeping whatever shows through its edges
+			c := canvas.NRGBAAt(x, y)
+			k := float64(cov) / 255
+			c.R = lerp(c.R, fill.R, k)
+			c.G = lerp(c.G, fill.G, k)
+			c.B = lerp(c.B, fill.B, k)
+			c.A = lerp(c.A, fill.A, k)
+			canvas.SetNRGBA(x, y, c)
+		}
+	}
+}
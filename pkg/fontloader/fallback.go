@@ -0,0 +1,202 @@
+package fontloader
+
+import (
+	"image"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+// WithFallback returns a font that takes every rune from the first of f and
+// the fallbacks that has it. Fallbacks are scaled to the line height of f and
+// share its baseline. Fonts that already have fallbacks have their chains
+// joined rather than nested
+func (f *Font) WithFallback(fallbacks ...*Font) *Font {
+	chain := &chainSource{}
+	primary := lineHeight(f.src)
+	for _, fb := range append([]*Font{f}, fallbacks...) {
+		ratio := 1.0
+		if lh := lineHeight(fb.src); lh > 0 && primary > 0 {
+			ratio = primary / lh
+		}
+		// Nested chains would pack their font into the glyph index twice
+		if c, ok := fb.src.(*chainSource); ok {
+			for i, src := range c.srcs {
+				chain.srcs = append(chain.srcs, src)
+				chain.ratios = append(chain.ratios, ratio*c.ratios[i])
+			}
+			continue
+		}
+		chain.srcs = append(chain.srcs, fb.src)
+		chain.ratios = append(chain.ratios, ratio)
+	}
+	return &Font{
+		data:      f.data,
+		index:     f.index,
+		name:      f.name,
+		fallbacks: append(append([]*Font{}, f.fallbacks...), fallbacks...),
+		src:       chain,
+	}
+}
+
+// lineHeight is ascent plus descent in ems, measured at a large size to keep
+// rounding out of it. A face that large would cache glyph masks far beyond
+// the memory at hand, only the metrics are read
+func lineHeight(src source) float64 {
+	const size = 1000
+	m := src.metrics(fixed.I(size))
+	return (m.Ascent + m.Descent) / size
+}
+
+// chainSource tries its sources in order, glyph indices carry the source in
+// the bits above chainShift
+type chainSource struct {
+	srcs   []source
+	ratios []float64
+}
+
+const chainShift = 16
+
+func (c *chainSource) find(r rune) (int, int) {
+	for i, src := range c.srcs {
+		if g := src.index(r); g != 0 {
+			return i, g
+		}
+	}
+	return 0, 0
+}
+
+func (c *chainSource) scaled(i int, scale fixed.Int26_6) fixed.Int26_6 {
+	return fixed.Int26_6(float64(scale)*c.ratios[i] + 0.5)
+}
+
+func (c *chainSource) clone() source {
+	clone := &chainSource{ratios: c.ratios}
+	for _, src := range c.srcs {
+		clone.srcs = append(clone.srcs, src.clone())
+	}
+	return clone
+}
+
+func (c *chainSource) index(r rune) int {
+	i, g := c.find(r)
+	if g == 0 {
+		return 0
+	}
+	return i<<chainShift | g
+}
+
+func (c *chainSource) glyphs() int {
+	var n int
+	for _, src := range c.srcs {
+		n += src.glyphs()
+	}
+	return n
+}
+
+func (c *chainSource) face(size, dpi float64, hinting font.Hinting) font.Face {
+	faces := make([]font.Face, len(c.srcs))
+	for i, src := range c.srcs {
+		faces[i] = src.face(size*c.ratios[i], dpi, hinting)
+	}
+	return &chainFace{chain: c, faces: faces}
+}
+
+func (c *chainSource) bounds(scale fixed.Int26_6) fixed.Rectangle26_6 {
+	b := c.srcs[0].bounds(scale)
+	for i := 1; i < len(c.srcs); i++ {
+		o := c.srcs[i].bounds(c.scaled(i, scale))
+		if o.Min.X < b.Min.X {
+			b.Min.X = o.Min.X
+		}
+		if o.Min.Y < b.Min.Y {
+			b.Min.Y = o.Min.Y
+		}
+		if o.Max.X > b.Max.X {
+			b.Max.X = o.Max.X
+		}
+		if o.Max.Y > b.Max.Y {
+			b.Max.Y = o.Max.Y
+		}
+	}
+	return b
+}
+
+func (c *chainSource) advance(scale fixed.Int26_6, r rune) fixed.Int26_6 {
+	i, _ := c.find(r)
+	return c.srcs[i].advance(c.scaled(i, scale), r)
+}
+
+func (c *chainSource) color(scale fixed.Int26_6, r rune) (*image.NRGBA, image.Point, bool) {
+	i, _ := c.find(r)
+	return c.srcs[i].color(c.scaled(i, scale), r)
+}
+
+// metrics are those of the primary font, which the others are scaled to
+func (c *chainSource) metrics(scale fixed.Int26_6) VerticalMetrics {
+	return c.srcs[0].metrics(scale)
+}
+
+func (c *chainSource) hasKern() bool {
+	for _, src := range c.srcs {
+		if src.hasKern() {
+			return true
+		}
+	}
+	return false
+}
+
+// kern only applies between glyphs of the same font
+func (c *chainSource) kern(scale fixed.Int26_6, left, right int) fixed.Int26_6 {
+	i := left >> chainShift
+	if right>>chainShift != i {
+		return 0
+	}
+	mask := 1<<chainShift - 1
+	return c.srcs[i].kern(c.scaled(i, scale), left&mask, right&mask)
+}
+
+func (c *chainSource) shape(scale fixed.Int26_6, hinting font.Hinting, r rune, origin sdf.Vec2) (sdf.Shape, error) {
+	i, _ := c.find(r)
+	return c.srcs[i].shape(c.scaled(i, scale), hinting, r, origin)
+}
+
+// chainFace routes every rune to the face of the font providing it, the
+// metrics are those of the primary font
+type chainFace struct {
+	chain *chainSource
+	faces []font.Face
+}
+
+func (f *chainFace) Close() error {
+	return nil
+}
+
+func (f *chainFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
+
+func (f *chainFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	i, _ := f.chain.find(r0)
+	if j, _ := f.chain.find(r1); i != j {
+		return 0
+	}
+	return f.faces[i].Kern(r0, r1)
+}
+
+func (f *chainFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	i, _ := f.chain.find(r)
+	return f.faces[i].Glyph(dot, r)
+}
+
+func (f *chainFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	i, _ := f.chain.find(r)
+	return f.faces[i].GlyphBounds(r)
+}
+
+func (f *chainFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	i, _ := f.chain.find(r)
+	return f.faces[i].GlyphAdvance(r)
+}
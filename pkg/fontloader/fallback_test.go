@@ -0,0 +1,62 @@
+package fontloader
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func parseTestFont(t *testing.T, data []byte) *Font {
+	t.Helper()
+	f, err := ParseFont(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// Chaining fallbacks one call at a time gives the same flat chain as a single
+// call, so glyph indices name the font that has the rune
+func TestWithFallbackTwice(t *testing.T) {
+	regular := parseTestFont(t, goregular.TTF)
+	mono := parseTestFont(t, gomono.TTF)
+	pragmono := loadTestFont(t, "../../pragmono.ttf")
+
+	want := regular.WithFallback(pragmono, mono).src.(*chainSource)
+	fonts := map[string]*Font{
+		"chained":         regular.WithFallback(pragmono).WithFallback(mono),
+		"nested fallback": regular.WithFallback(pragmono.WithFallback(mono)),
+	}
+	for name, f := range fonts {
+		t.Run(name, func(t *testing.T) {
+			c := f.src.(*chainSource)
+			if len(c.srcs) != 3 {
+				t.Fatalf("chain of %d fonts, want 3", len(c.srcs))
+			}
+			for i, src := range c.srcs {
+				if _, ok := src.(*chainSource); ok {
+					t.Fatalf("font %d is a nested chain", i)
+				}
+				if math.Abs(c.ratios[i]-want.ratios[i]) > 1e-9 {
+					t.Fatalf("font %d scaled by %f, want %f", i, c.ratios[i], want.ratios[i])
+				}
+			}
+			// ƀ is only in pragmono, the second font
+			mask := 1<<chainShift - 1
+			for _, r := range "Aƀ" {
+				g := c.index(r)
+				if g != want.index(r) {
+					t.Fatalf("%q has index %x, want %x", r, g, want.index(r))
+				}
+				if src := c.srcs[g>>chainShift]; src.index(r) != g&mask {
+					t.Fatalf("index %x of %q names a font without it", g, r)
+				}
+			}
+			if c.index('ƀ')>>chainShift != 1 {
+				t.Fatalf("ƀ resolved to font %d, want 1", c.index('ƀ')>>chainShift)
+			}
+		})
+	}
+}
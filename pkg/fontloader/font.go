@@ -0,0 +1,107 @@
+package fontloader
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+
+	"github.com/golang/freetype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// Font is a parsed font that charsets of any size and mode can be rendered
+// from without parsing it again
+type Font struct {
+	data  []byte
+	index int
+	name  string
+	// fallbacks are the fonts chained after this one by WithFallback
+	fallbacks []*Font
+	src       source
+}
+
+// ParseFont parses a font from its raw bytes, the bytes are kept and should
+// not be modified afterwards. For collections the first face is used
+func ParseFont(data []byte) (*Font, error) {
+	return ParseFontIndex(data, 0)
+}
+
+// ParseFontIndex parses a face from a font collection (.ttc, .otc), or a
+// single font if index is 0. TrueType fonts are read by freetype for
+// hinting support, everything else by sfnt
+func ParseFontIndex(data []byte, index int) (*Font, error) {
+	// Broken color tables only cost the color glyphs, outlines are drawn
+	// in their place
+	colors, err := parseColorTables(data, index)
+	if err != nil {
+		colors = nil
+	}
+	if index == 0 && isTrueType(data) {
+		if ft, err := freetype.ParseFont(data); err == nil {
+			sf, _ := sfnt.Parse(data)
+			return &Font{
+				data: data,
+				name: familyName(sf),
+				src:  &truetypeSource{ft: ft, kerning: hasTable(data, "kern"), sf: sf, colors: colors},
+			}, nil
+		}
+	}
+
+	c, err := sfnt.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse font: %w", err)
+	}
+	if index < 0 || index >= c.NumFonts() {
+		return nil, fmt.Errorf("no face %d in font with %d faces", index, c.NumFonts())
+	}
+	f, err := c.Font(index)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse face %d: %w", index, err)
+	}
+	return &Font{data: data, index: index, name: familyName(f), src: &sfntSource{f: f, colors: colors}}, nil
+}
+
+// familyName is the family name in the name table, if any
+func familyName(f *sfnt.Font) string {
+	if f == nil {
+		return ""
+	}
+	name, _ := f.Name(nil, sfnt.NameIDFamily)
+	return name
+}
+
+// ReadFont reads all of r and parses it as a font
+func ReadFont(r io.Reader) (*Font, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read font: %w", err)
+	}
+	return ParseFont(data)
+}
+
+// OpenFont parses a font from a filesystem, such as an embed.FS
+func OpenFont(fsys fs.FS, name string) (*Font, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read font \"%s\": %w", name, err)
+	}
+	f, err := ParseFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("font \"%s\": %w", name, err)
+	}
+	return f, nil
+}
+
+// LoadFont parses a font file
+func LoadFont(filepath string) (*Font, error) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read font \"%s\": %w", filepath, err)
+	}
+	f, err := ParseFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("font \"%s\": %w", filepath, err)
+	}
+	return f, nil
+}
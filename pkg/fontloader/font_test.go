@@ -0,0 +1,119 @@
+package fontloader
+
+import (
+	"sort"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// testCollection packs fonts into a collection, each face keeping its tables
+func testCollection(t *testing.T, fonts ...[]byte) []byte {
+	t.Helper()
+	var header, body tableBuf
+	header.WriteString("ttcf")
+	header.u16(1)
+	header.u16(0)
+	header.u32(len(fonts))
+	offset := 12 + 4*len(fonts)
+	for _, data := range fonts {
+		tables, err := fontTables(data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tags []string
+		for tag := range tables {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		header.u32(offset + body.Len())
+		dirLen := 12 + 16*len(tags)
+		var dir, face tableBuf
+		dir.Write(data[:4])
+		dir.u16(len(tags))
+		dir.u16(16)
+		dir.u16(4)
+		dir.u16(len(tags)*16 - 256)
+		for _, tag := range tags {
+			dir.WriteString(tag)
+			dir.u32(0)
+			dir.u32(offset + body.Len() + dirLen + face.Len())
+			dir.u32(len(tables[tag]))
+			face.Write(tables[tag])
+			for face.Len()%4 != 0 {
+				face.u8(0)
+			}
+		}
+		body.Write(dir.Bytes())
+		body.Write(face.Bytes())
+	}
+	return append(header.Bytes(), body.Bytes()...)
+}
+
+func TestCFF(t *testing.T) {
+	f := loadTestFont(t, "testdata/CFFTest.otf")
+	if _, ok := f.src.(*sfntSource); !ok || f.name != "CFFTest" {
+		t.Fatalf("read %q with %T, want CFFTest through sfnt", f.name, f.src)
+	}
+	for _, mode := range []Mode{ModeBitmap, ModeSDF, ModeMSDF} {
+		c, err := f.Charset(LoadOptions{Mode: mode, Padding: 2, Text: "01Q中"})
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if len(c.Missing) != 0 {
+			t.Fatalf("%s: missing %q", mode, c.Missing)
+		}
+		for _, r := range "01Q中" {
+			g := c.Glyphs[r]
+			if g.Width == 0 || g.Height == 0 || g.Advance == 0 {
+				t.Fatalf("%s: glyph %q is %+v", mode, r, g)
+			}
+			var ink bool
+			for y := g.Y; y < g.Y+g.Height; y++ {
+				for x := g.X; x < g.X+g.Width; x++ {
+					if c.Pages[g.Page].RGBAAt(x, y).A > 128 {
+						ink = true
+					}
+				}
+			}
+			if !ink {
+				t.Fatalf("%s: glyph %q has no ink", mode, r)
+			}
+		}
+	}
+}
+
+func TestCollection(t *testing.T) {
+	data := testCollection(t, goregular.TTF, gomono.TTF)
+	for i, name := range []string{"Go", "Go Mono"} {
+		f, err := ParseFontIndex(data, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.name != name {
+			t.Fatalf("face %d is %q, want %q", i, f.name, name)
+		}
+		c, err := f.Charset(LoadOptions{Text: "im"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only the monospaced face has i as wide as m
+		if mono := c.Glyphs['i'].Advance == c.Glyphs['m'].Advance; mono != (i == 1) {
+			t.Fatalf("face %d advances are %f and %f", i, c.Glyphs['i'].Advance, c.Glyphs['m'].Advance)
+		}
+	}
+
+	if f, err := ParseFont(data); err != nil || f.name != "Go" {
+		t.Fatalf("parsed %v, want the first face: %v", f, err)
+	}
+	for _, i := range []int{-1, 2} {
+		if _, err := ParseFontIndex(data, i); err == nil {
+			t.Fatalf("parsed face %d of 2", i)
+		}
+	}
+	if _, err := ParseFont([]byte("not a font")); err == nil {
+		t.Fatal("parsed garbage")
+	}
+}
@@ -2,30 +2,318 @@ package fontloader
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"image"
-	"image/color"
-	"image/draw"
 	"image/png"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
-	"github.com/golang/freetype"
 	"golang.org/x/image/font"
+
+	"github.com/perlw/sandbox_go/pkg/packer"
+)
+
+// Mode selects what kind of atlas is rendered
+type Mode string
+
+// Available modes
+const (
+	// ModeBitmap renders plain coverage as white alpha
+	ModeBitmap Mode = "bitmap"
+	// ModeSDF renders a signed distance field in the color channels
+	ModeSDF Mode = "sdf"
+	// ModeMSDF renders a multi-channel signed distance field from the outlines
+	ModeMSDF Mode = "msdf"
+	// ModeLCD renders coverage of the red, green and blue subpixels of a
+	// horizontal RGB display in the color channels, alpha holds the largest
+	ModeLCD Mode = "lcd"
+)
+
+// LCD filters spread every subpixel over its neighbours to tone down color
+// fringes, the weights are normalized to sum to 1
+var (
+	// LCDFilterDefault is the FreeType default filter
+	LCDFilterDefault = []float64{0x08, 0x4D, 0x56, 0x4D, 0x08}
+	// LCDFilterLight is sharper, with more fringing
+	LCDFilterLight = []float64{0x00, 0x55, 0x56, 0x55, 0x00}
+	// LCDFilterNone leaves subpixels as they are
+	LCDFilterNone = []float64{1}
 )
 
+// RuneRange is an inclusive range of runes
+type RuneRange struct {
+	First rune `json:"first"`
+	Last  rune `json:"last"`
+}
+
+// LoadOptions controls how the atlas is rendered, the zero value renders the
+// default 16pt bitmap atlas of runes 32-255 at 72 DPI
+type LoadOptions struct {
+	// Size is the font size in points, defaults to 16
+	Size float64
+	// DPI defaults to 72, making points and pixels the same
+	DPI     float64
+	Hinting font.Hinting
+	// CellWidth and CellHeight give every glyph the same cell, padding
+	// excluded, a missing side is sized from the font bounds. If both are 0
+	// glyphs are cropped to their ink
+	CellWidth  int
+	CellHeight int
+	// AtlasWidth and AtlasHeight fix the page size, if 0 pages start at
+	// 256x256 and double in size up to MaxAtlasWidth and MaxAtlasHeight
+	AtlasWidth     int
+	AtlasHeight    int
+	MaxAtlasWidth  int
+	MaxAtlasHeight int
+	// Padding is added around every glyph, in sdf modes it is the spread
+	Padding int
+	// Gutter is the empty space kept between glyphs in the atlas
+	Gutter int
+	// Ranges and Text select the runes to render, runes 32-255 if both are
+	// empty
+	Ranges []RuneRange
+	Text   string
+	Mode   Mode
+	// SDFOversample is how many times larger glyphs are rendered before
+	// being turned into a distance field in sdf mode, defaults to 8
+	SDFOversample int
+	// Effects are applied in order to every glyph in bitmap mode
+	Effects []Effect
+	// LCDFilter weighs the subpixels around each one in lcd mode, it needs
+	// an odd number of weights centered on the subpixel and defaults to
+	// LCDFilterDefault
+	LCDFilter []float64
+	// MipLevels is how many levels, each half the size of the one above, are
+	// rendered below every page. Glyphs are aligned to the lowest level and
+	// the gutter raised to keep a texel between them there
+	MipLevels int
+	// Workers is how many glyphs are rendered at once, defaults to the
+	// number of CPUs. The atlas is the same for any number of workers
+	Workers int
+	// Dynamic keeps the font around so runes missing from the atlas are
+	// rendered and packed on first use
+	Dynamic bool
+}
+
+func (o *LoadOptions) normalize() error {
+	if o.Size < 0 {
+		return fmt.Errorf("invalid size %f", o.Size)
+	}
+	if o.Size == 0 {
+		o.Size = 16
+	}
+	if o.DPI < 0 {
+		return fmt.Errorf("invalid dpi %f", o.DPI)
+	}
+	if o.DPI == 0 {
+		o.DPI = 72
+	}
+	if o.CellWidth < 0 || o.CellHeight < 0 {
+		return fmt.Errorf("invalid cell size %dx%d", o.CellWidth, o.CellHeight)
+	}
+	if o.AtlasWidth < 0 || o.AtlasHeight < 0 {
+		return fmt.Errorf("invalid atlas size %dx%d", o.AtlasWidth, o.AtlasHeight)
+	}
+	if o.MaxAtlasWidth < 0 || o.MaxAtlasHeight < 0 {
+		return fmt.Errorf("invalid max atlas size %dx%d", o.MaxAtlasWidth, o.MaxAtlasHeight)
+	}
+	if o.MaxAtlasWidth == 0 {
+		o.MaxAtlasWidth = 4096
+	}
+	if o.MaxAtlasHeight == 0 {
+		o.MaxAtlasHeight = 4096
+	}
+	if o.Gutter < 0 {
+		return fmt.Errorf("invalid gutter %d", o.Gutter)
+	}
+	if o.Padding < 0 {
+		return fmt.Errorf("invalid padding %d", o.Padding)
+	}
+	if len(o.Ranges) == 0 && o.Text == "" {
+		o.Ranges = []RuneRange{{First: 32, Last: 255}}
+	}
+	for _, r := range o.Ranges {
+		if r.First > r.Last {
+			return fmt.Errorf("invalid rune range %d-%d", r.First, r.Last)
+		}
+	}
+	if o.SDFOversample < 0 {
+		return fmt.Errorf("invalid sdf oversample %d", o.SDFOversample)
+	}
+	if o.SDFOversample == 0 {
+		o.SDFOversample = 8
+	}
+	if o.MipLevels < 0 || o.MipLevels > 12 {
+		return fmt.Errorf("invalid mip levels %d", o.MipLevels)
+	}
+	if o.MipLevels > 0 && o.Gutter < 1<<o.MipLevels {
+		o.Gutter = 1 << o.MipLevels
+	}
+	if o.Workers < 0 {
+		return fmt.Errorf("invalid workers %d", o.Workers)
+	}
+	if o.Workers == 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	switch o.Mode {
+	case "":
+		o.Mode = ModeBitmap
+	case ModeBitmap:
+	case ModeSDF, ModeMSDF:
+		if len(o.Effects) > 0 {
+			return fmt.Errorf("mode %s does not support effects", o.Mode)
+		}
+		if o.Padding == 0 {
+			return fmt.Errorf("mode %s needs padding to hold the distance field", o.Mode)
+		}
+	case ModeLCD:
+		if len(o.Effects) > 0 {
+			return fmt.Errorf("mode %s does not support effects", o.Mode)
+		}
+		if o.MipLevels > 0 {
+			return fmt.Errorf("mode %s does not support mip levels", o.Mode)
+		}
+		if o.LCDFilter == nil {
+			o.LCDFilter = LCDFilterDefault
+		}
+		if len(o.LCDFilter)%2 == 0 {
+			return fmt.Errorf("lcd filter needs an odd number of weights, got %d", len(o.LCDFilter))
+		}
+		var sum float64
+		for _, w := range o.LCDFilter {
+			if w < 0 {
+				return fmt.Errorf("invalid lcd filter weight %f", w)
+			}
+			sum += w
+		}
+		if sum == 0 {
+			return fmt.Errorf("lcd filter weights sum to 0")
+		}
+		filter := make([]float64, len(o.LCDFilter))
+		for i, w := range o.LCDFilter {
+			filter[i] = w / sum
+		}
+		o.LCDFilter = filter
+	default:
+		return fmt.Errorf("unknown mode \"%s\"", o.Mode)
+	}
+	return nil
+}
+
+// Glyph locates a rune in the atlas and describes how to place it relative
+// to the pen position on the baseline
 type Glyph struct {
+	Rune rune `json:"rune"`
+	// Page, X, Y, Width and Height is the rectangle in the atlas, padding
+	// included. Glyphs without ink have no rectangle
+	Page   int `json:"page"`
 	X      int `json:"x"`
 	Y      int `json:"y"`
 	Width  int `json:"width"`
 	Height int `json:"height"`
+	// Bearing is the horizontal offset from the pen to the left of the
+	// rectangle, the left side bearing of the glyph minus the padding
+	Bearing int `json:"bearing"`
+	// Baseline is the offset from the top of the rectangle down to the baseline
+	Baseline int `json:"baseline"`
+	// Advance is how far to move the pen after the glyph
+	Advance float64 `json:"advance"`
+	// Color is set for glyphs stored in full color, which should be drawn
+	// without tinting
+	Color bool `json:"color,omitempty"`
 }
 
+// Charset is a rendered atlas and the glyphs in it. A dynamic charset
+// changes on lookups and is not safe for concurrent use
 type Charset struct {
-	Image *image.RGBA
+	// Image is the first page, which is all of the atlas unless it outgrew
+	// the max atlas size
+	Image *image.RGBA   `json:"-"`
+	Pages []*image.RGBA `json:"-"`
+	// Mipmaps holds the levels below each page, halving in size
+	Mipmaps   [][]*image.RGBA `json:"-"`
+	MipLevels int             `json:"mipLevels,omitempty"`
+	// Face is the family name of the font
+	Face    string  `json:"face,omitempty"`
+	Size    float64 `json:"size"`
+	DPI     float64 `json:"dpi"`
+	Mode    Mode    `json:"mode"`
+	Padding int     `json:"padding"`
+	// Spread is the distance in pixels from the edge to a saturated value in
+	// the sdf modes, 0 for bitmaps
+	Spread float64 `json:"spread,omitempty"`
+	VerticalMetrics
+	Glyphs  map[rune]Glyph `json:"glyphs"`
+	Kerning []Kerning      `json:"kerning,omitempty"`
+	// Missing lists the requested runes the font has no glyph for, leaving
+	// out controls and other runes that are never drawn
+	Missing []rune `json:"missing,omitempty"`
+
+	kerning map[[2]rune]float64
+	missing map[rune]bool
+	dynamic *dynamic
+}
+
+// Glyph looks up the glyph for a rune, rendering it first if the charset is
+// dynamic
+func (c *Charset) Glyph(r rune) (Glyph, bool) {
+	g, ok := c.Glyphs[r]
+	if !ok && c.dynamic != nil {
+		return c.add(r)
+	}
+	return g, ok
 }
 
-func (c *Charset) Save(filepath string) error {
+// Kern returns the adjustment to the advance between left and right
+func (c *Charset) Kern(left, right rune) float64 {
+	if c.kerning == nil {
+		c.kerning = make(map[[2]rune]float64, len(c.Kerning))
+		for _, k := range c.Kerning {
+			c.kerning[[2]rune{k.First, k.Second}] = k.Amount
+		}
+	}
+	return c.kerning[[2]rune{left, right}]
+}
+
+// MarshalJSON serialises the glyph metrics together with the page sizes
+func (c *Charset) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.sidecar(nil))
+}
+
+// PagePath returns the file a page is saved to, the first page uses path as is
+// and the others get the page number appended
+func PagePath(path string, page int) string {
+	if page == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), page, ext)
+}
+
+// SaveMetrics writes the glyph metrics as json
+func (c *Charset) SaveMetrics(filepath string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not json encode \"%s\": %w", filepath, err)
+	}
+	if err := ioutil.WriteFile(filepath, data, 0644); err != nil {
+		return fmt.Errorf("could not write file \"%s\": %w", filepath, err)
+	}
+	return nil
+}
+
+// encodePNG writes a page as it is stored, png.Encode would take the RGBA for
+// premultiplied and divide the color by alpha
+func encodePNG(w io.Writer, img *image.RGBA) error {
+	return png.Encode(w, &image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect})
+}
+
+func savePNG(img *image.RGBA, filepath string) error {
 	outFile, err := os.Create(filepath)
 	if err != nil {
 		return fmt.Errorf("could not create file \"%s\": %w", filepath, err)
@@ -33,7 +321,7 @@ func (c *Charset) Save(filepath string) error {
 	defer outFile.Close()
 
 	b := bufio.NewWriter(outFile)
-	err = png.Encode(b, c.Image)
+	err = encodePNG(b, img)
 	if err != nil {
 		return fmt.Errorf("could not png encode \"%s\": %w", filepath, err)
 	}
@@ -46,69 +334,145 @@ func (c *Charset) Save(filepath string) error {
 }
 
 func LoadTTF(filepath string) (*Charset, error) {
-	fontBytes, err := ioutil.ReadFile(filepath)
+	return LoadTTFWithOptions(filepath, LoadOptions{})
+}
+
+func LoadTTFWithOptions(filepath string, opts LoadOptions) (*Charset, error) {
+	f, err := LoadFont(filepath)
 	if err != nil {
-		return nil, fmt.Errorf("could not read font \"%s\": %w", filepath, err)
+		return nil, err
+	}
+	return f.Charset(opts)
+}
+
+// Charset renders an atlas of the font
+func (f *Font) Charset(opts LoadOptions) (*Charset, error) {
+	if err := opts.normalize(); err != nil {
+		return nil, err
 	}
-	ft, err := freetype.ParseFont(fontBytes)
+	charsets, rasts, pack, err := f.build(opts, []float64{opts.Size})
 	if err != nil {
-		return nil, fmt.Errorf("could not parse font \"%s\": %w", filepath, err)
-	}
-	size := 16
-	fg, bg := image.White, image.Black
-	rgba := image.NewGray(image.Rect(0, 0, 256, 256))
-	draw.Draw(rgba, rgba.Bounds(), bg, image.ZP, draw.Src)
-	c := freetype.NewContext()
-	c.SetDPI(72)
-	c.SetFont(ft)
-	c.SetFontSize(float64(size))
-	c.SetClip(rgba.Bounds())
-	c.SetDst(rgba)
-	c.SetSrc(fg)
-	c.SetHinting(font.HintingNone)
-
-	gw := 8
-	gh := 16
-
-	var gi int
-	var x, y int
-	var gstart, gend rune = 32, 255
-	glyphs := make([]Glyph, gend-gstart+1)
-	for r := gstart; r <= gend; r++ {
-		glyphs[gi].X = x
-		glyphs[gi].Y = y - gh
-		glyphs[gi].Width = gw
-		glyphs[gi].Height = gh
-		pt := freetype.Pt(x, y-2)
-		c.DrawString(string(r), pt)
-
-		if gi%32 == 0 {
-			x = 0
-			y += gh
-		} else {
-			x += gw
-		}
-
-		gi++
-	}
-
-	fontImg := image.NewRGBA(rgba.Bounds())
-	for y := 0; y < rgba.Bounds().Dy(); y++ {
-		for x := 0; x < rgba.Bounds().Dx(); x++ {
-			curr := rgba.At(x, y).(color.Gray)
-			fontImg.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: curr.Y})
-			if x == 0 || y == 0 {
+		return nil, err
+	}
+	charset := charsets[0]
+	if opts.Dynamic {
+		charset.dynamic = &dynamic{
+			rast: rasts[0],
+			pack: pack,
+		}
+	}
+	return charset, nil
+}
+
+// build renders a charset per size into shared pages
+func (f *Font) build(opts LoadOptions, sizes []float64) ([]*Charset, []*rasterizer, *packer.Packer, error) {
+	runes := opts.runes()
+	charsets := make([]*Charset, len(sizes))
+	rasts := make([]*rasterizer, len(sizes))
+	var imgs []*image.RGBA
+	var glyphs []Glyph
+	var owners []int
+	for i, size := range sizes {
+		o := opts
+		o.Size = size
+		rast := newRasterizer(f.src, o)
+		charset := &Charset{
+			Face:      f.name,
+			Size:      size,
+			DPI:       opts.DPI,
+			Mode:      opts.Mode,
+			Padding:   opts.Padding,
+			MipLevels: opts.MipLevels,
+			Glyphs:    make(map[rune]Glyph, len(runes)),
+			missing:   map[rune]bool{},
+		}
+
+		var present []rune
+		for _, r := range runes {
+			if f.src.index(r) == 0 {
+				charset.addMissing(r)
 				continue
 			}
+			present = append(present, r)
+		}
+		rendered, gs, err := renderAll(f.src, o, present)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		imgs = append(imgs, rendered...)
+		glyphs = append(glyphs, gs...)
+		for range gs {
+			owners = append(owners, i)
+		}
+
+		charset.VerticalMetrics = verticalMetrics(f.src, rast.face, rast.scale)
+		if opts.Mode == ModeSDF || opts.Mode == ModeMSDF {
+			charset.Spread = float64(opts.Padding)
+		}
+		charset.Kerning = kerningPairs(f.src, rast.scale, present)
+		charsets[i], rasts[i] = charset, rast
+	}
+
+	boxes := make([]image.Point, len(glyphs))
+	for i, g := range glyphs {
+		boxes[i] = image.Pt(g.Width, g.Height)
+	}
+	pack := newPacker(opts)
+	rects, err := pack.PackAll(boxes)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not pack glyphs: %w", err)
+	}
+	charsets[0].resize(pack)
+	for _, c := range charsets[1:] {
+		c.Image, c.Pages = charsets[0].Image, charsets[0].Pages
+	}
+	for i, rect := range rects {
+		charsets[owners[i]].draw(imgs[i], &glyphs[i], rect)
+	}
+	if opts.MipLevels > 0 {
+		charsets[0].buildMipmaps()
+		for _, c := range charsets[1:] {
+			c.Mipmaps = charsets[0].Mipmaps
+		}
+	}
+	return charsets, rasts, pack, nil
+}
 
-			prev := rgba.At(x-1, y-1).(color.Gray)
-			if prev.Y >= 128 && curr.Y < 128 {
-				fontImg.Set(x, y, color.RGBA{R: 0, G: 0, B: 0, A: 255})
+// runes lists the runes from the ranges followed by those in the text, once
+// each
+func (o *LoadOptions) runes() []rune {
+	seen := map[rune]bool{}
+	var runes []rune
+	for _, rr := range o.Ranges {
+		for r := rr.First; r <= rr.Last; r++ {
+			if !seen[r] {
+				seen[r] = true
+				runes = append(runes, r)
 			}
 		}
 	}
+	for _, r := range o.Text {
+		if !seen[r] {
+			seen[r] = true
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
 
-	return &Charset{
-		Image: fontImg,
-	}, nil
+func newPacker(opts LoadOptions) *packer.Packer {
+	if opts.AtlasWidth > 0 || opts.AtlasHeight > 0 {
+		return packer.New(packer.Options{
+			Width:  opts.AtlasWidth,
+			Height: opts.AtlasHeight,
+			Gutter: opts.Gutter,
+			Align:  1 << opts.MipLevels,
+		})
+	}
+	return packer.New(packer.Options{
+		MaxWidth:  opts.MaxAtlasWidth,
+		MaxHeight: opts.MaxAtlasHeight,
+		Gutter:    opts.Gutter,
+		Align:     1 << opts.MipLevels,
+	})
 }
@@ -0,0 +1,53 @@
+package fontloader
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPagePath(t *testing.T) {
+	dir := filepath.Join("fonts.v2", "out")
+	tests := []struct {
+		path string
+		page int
+		want string
+	}{
+		{filepath.Join(dir, "atlas.png"), 0, filepath.Join(dir, "atlas.png")},
+		{filepath.Join(dir, "atlas.png"), 2, filepath.Join(dir, "atlas_2.png")},
+		// The dot in the directory is not the extension
+		{filepath.Join(dir, "atlas"), 1, filepath.Join(dir, "atlas_1")},
+	}
+	for _, tt := range tests {
+		if got := PagePath(tt.path, tt.page); got != tt.want {
+			t.Fatalf("page %d of %s is %s, want %s", tt.page, tt.path, got, tt.want)
+		}
+	}
+}
+
+// Glyphs larger than the largest power of two page still fit below the max
+func TestMaxAtlasSize(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	done := make(chan error, 1)
+	var c *Charset
+	go func() {
+		var err error
+		c, err = f.Charset(LoadOptions{Size: 600, Text: "W", MaxAtlasWidth: 1000, MaxAtlasHeight: 1000})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("charset with a glyph past the last doubling did not finish")
+	}
+	b := c.Pages[0].Bounds()
+	if len(c.Pages) != 1 || b.Dx() > 1000 || b.Dy() > 1000 {
+		t.Fatalf("got %d pages of %v, want one within 1000x1000", len(c.Pages), b)
+	}
+	if g := c.Glyphs['W']; g.Width == 0 || g.X+g.Width > b.Dx() || g.Y+g.Height > b.Dy() {
+		t.Fatalf("glyph %+v outside page %v", g, b)
+	}
+}
@@ -0,0 +1,74 @@
+package fontloader
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// Kerning adjusts the advance between two runes
+type Kerning struct {
+	First  rune    `json:"first"`
+	Second rune    `json:"second"`
+	Amount float64 `json:"amount"`
+}
+
+// hasTable checks the sfnt table directory for a table
+func hasTable(fontBytes []byte, tag string) bool {
+	if len(fontBytes) < 12 {
+		return false
+	}
+	numTables := int(binary.BigEndian.Uint16(fontBytes[4:]))
+	for i := 0; i < numTables; i++ {
+		offset := 12 + i*16
+		if offset+16 > len(fontBytes) {
+			return false
+		}
+		if string(fontBytes[offset:offset+4]) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// kerningPairs collects every non-zero kerning pair between the runes, only
+// walking the pairs if the font has kerning at all
+func kerningPairs(src source, scale fixed.Int26_6, runes []rune) []Kerning {
+	if !src.hasKern() {
+		return nil
+	}
+
+	// Runes sharing a glyph share the kerning
+	byIndex := map[int][]rune{}
+	var indices []int
+	for _, r := range runes {
+		i := src.index(r)
+		if i == 0 {
+			continue
+		}
+		if _, ok := byIndex[i]; !ok {
+			indices = append(indices, i)
+		}
+		byIndex[i] = append(byIndex[i], r)
+	}
+
+	var pairs []Kerning
+	for _, left := range indices {
+		for _, right := range indices {
+			kern := src.kern(scale, left, right)
+			if kern == 0 {
+				continue
+			}
+			for _, l := range byIndex[left] {
+				for _, r := range byIndex[right] {
+					pairs = append(pairs, Kerning{
+						First:  l,
+						Second: r,
+						Amount: float64(kern) / 64,
+					})
+				}
+			}
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,237 @@
+package fontloader
+
+import (
+	"container/list"
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// LRUAtlas is a single fixed size page of equal cells that glyphs are
+// rendered into on first use, evicting the least recently used glyph when
+// full. Glyphs used since the last call to Frame are never evicted, so
+// everything looked up for a frame stays valid until it is drawn. It is not
+// safe for concurrent use
+type LRUAtlas struct {
+	Image   *image.RGBA
+	Size    float64
+	DPI     float64
+	Mode    Mode
+	Padding int
+	Spread  float64
+	VerticalMetrics
+
+	rast                  *rasterizer
+	cellWidth, cellHeight int
+	gutter, columns       int
+	cells                 int
+	free                  []int
+	// lru holds the runes with a cell, most recently used first
+	lru     *list.List
+	glyphs  map[rune]*lruGlyph
+	missing map[rune]bool
+	kerning map[[2]rune]float64
+	frame   int
+	dirty   map[int]bool
+}
+
+type lruGlyph struct {
+	glyph Glyph
+	cell  int
+	frame int
+	elem  *list.Element
+}
+
+// LRUAtlas creates an atlas of AtlasWidth by AtlasHeight, 1024x1024 if not
+// set, with cells the size of the font bounds or CellWidth by CellHeight. The
+// runes in the ranges or text are rendered up front for as long as they fit.
+// Mip levels and multiple pages are not supported
+func (f *Font) LRUAtlas(opts LoadOptions) (*LRUAtlas, error) {
+	preload := len(opts.Ranges) > 0 || opts.Text != ""
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	if opts.MipLevels > 0 {
+		return nil, fmt.Errorf("lru atlases do not support mip levels")
+	}
+	if opts.AtlasWidth == 0 {
+		opts.AtlasWidth = 1024
+	}
+	if opts.AtlasHeight == 0 {
+		opts.AtlasHeight = 1024
+	}
+
+	rast := newRasterizer(f.src, opts)
+	a := &LRUAtlas{
+		Image:   image.NewRGBA(image.Rect(0, 0, opts.AtlasWidth, opts.AtlasHeight)),
+		Size:    opts.Size,
+		DPI:     opts.DPI,
+		Mode:    opts.Mode,
+		Padding: opts.Padding,
+		rast:    rast,
+		gutter:  opts.Gutter,
+		lru:     list.New(),
+		glyphs:  map[rune]*lruGlyph{},
+		missing: map[rune]bool{},
+		kerning: map[[2]rune]float64{},
+		dirty:   map[int]bool{},
+	}
+	a.VerticalMetrics = verticalMetrics(f.src, rast.face, rast.scale)
+	if opts.Mode == ModeSDF || opts.Mode == ModeMSDF {
+		a.Spread = float64(opts.Padding)
+	}
+
+	// Cells hold the bounds of every glyph in the font, with room for
+	// rounding the ink out to whole pixels, so any rune can be rendered later
+	a.cellWidth, a.cellHeight = rast.cellWidth, rast.cellHeight
+	if a.cellWidth == 0 {
+		bounds := f.src.bounds(rast.scale)
+		a.cellWidth = bounds.Max.X.Ceil() - bounds.Min.X.Floor() + 2
+		a.cellHeight = bounds.Max.Y.Ceil() - bounds.Min.Y.Floor() + 2
+		if opts.Mode == ModeLCD {
+			a.cellWidth += (len(opts.LCDFilter)/2 + 2) / 3 * 2
+		}
+	}
+	m := effectMargins(opts.Effects)
+	a.cellWidth += opts.Padding*2 + m[0] + m[2]
+	a.cellHeight += opts.Padding*2 + m[1] + m[3]
+
+	a.columns = (opts.AtlasWidth + a.gutter) / (a.cellWidth + a.gutter)
+	rows := (opts.AtlasHeight + a.gutter) / (a.cellHeight + a.gutter)
+	if a.columns == 0 || rows == 0 {
+		return nil, fmt.Errorf("atlas %dx%d can not hold a %dx%d cell", opts.AtlasWidth, opts.AtlasHeight, a.cellWidth, a.cellHeight)
+	}
+	a.cells = a.columns * rows
+	for i := a.cells - 1; i >= 0; i-- {
+		a.free = append(a.free, i)
+	}
+
+	if preload {
+		for _, r := range opts.runes() {
+			if len(a.free) == 0 {
+				break
+			}
+			a.Glyph(r)
+		}
+	}
+	return a, nil
+}
+
+// Capacity is how many glyphs with ink fit in the atlas at once
+func (a *LRUAtlas) Capacity() int {
+	return a.cells
+}
+
+// Frame starts a new frame, letting glyphs used so far be evicted
+func (a *LRUAtlas) Frame() {
+	a.frame++
+}
+
+// Glyph looks up the glyph for a rune, rendering it into a free cell or the
+// least recently used one first. It fails for runes the font does not have,
+// glyphs too large for a cell, such as color bitmaps reaching past the font
+// bounds, and when every cell is in use this frame
+func (a *LRUAtlas) Glyph(r rune) (Glyph, bool) {
+	if e, ok := a.glyphs[r]; ok {
+		e.frame = a.frame
+		if e.elem != nil {
+			a.lru.MoveToFront(e.elem)
+		}
+		return e.glyph, true
+	}
+	if a.missing[r] || a.rast.src.index(r) == 0 {
+		a.missing[r] = true
+		return Glyph{}, false
+	}
+
+	img, g, err := a.rast.render(r)
+	if err != nil {
+		a.missing[r] = true
+		return Glyph{}, false
+	}
+	if g.Width > a.cellWidth || g.Height > a.cellHeight {
+		return Glyph{}, false
+	}
+	// Glyphs without ink need no cell and are never evicted
+	if img == nil {
+		a.glyphs[r] = &lruGlyph{glyph: g, cell: -1, frame: a.frame}
+		return g, true
+	}
+
+	cell, ok := a.allocate()
+	if !ok {
+		return Glyph{}, false
+	}
+	rect := a.cell(cell)
+	draw.Draw(a.Image, rect, image.Transparent, image.ZP, draw.Src)
+	g.X, g.Y = rect.Min.X, rect.Min.Y
+	draw.Draw(a.Image, image.Rect(g.X, g.Y, g.X+g.Width, g.Y+g.Height), img, image.ZP, draw.Src)
+	a.dirty[cell] = true
+
+	e := &lruGlyph{glyph: g, cell: cell, frame: a.frame}
+	e.elem = a.lru.PushFront(r)
+	a.glyphs[r] = e
+	return g, true
+}
+
+// allocate takes a free cell, or evicts the least recently used glyph
+func (a *LRUAtlas) allocate() (int, bool) {
+	if n := len(a.free); n > 0 {
+		cell := a.free[n-1]
+		a.free = a.free[:n-1]
+		return cell, true
+	}
+	back := a.lru.Back()
+	if back == nil {
+		return 0, false
+	}
+	r := back.Value.(rune)
+	e := a.glyphs[r]
+	if e.frame == a.frame {
+		return 0, false
+	}
+	a.lru.Remove(back)
+	delete(a.glyphs, r)
+	return e.cell, true
+}
+
+func (a *LRUAtlas) cell(i int) image.Rectangle {
+	x := (i % a.columns) * (a.cellWidth + a.gutter)
+	y := (i / a.columns) * (a.cellHeight + a.gutter)
+	return image.Rect(x, y, x+a.cellWidth, y+a.cellHeight)
+}
+
+// Kern returns the adjustment to the advance between left and right
+func (a *LRUAtlas) Kern(left, right rune) float64 {
+	key := [2]rune{left, right}
+	if k, ok := a.kerning[key]; ok {
+		return k
+	}
+	src := a.rast.src
+	var k float64
+	if src.hasKern() {
+		l, r := src.index(left), src.index(right)
+		if l != 0 && r != 0 {
+			k = float64(src.kern(a.rast.scale, l, r)) / 64
+		}
+	}
+	a.kerning[key] = k
+	return k
+}
+
+// Dirty returns the areas of Image changed since the last call, in the order
+// of the cells
+func (a *LRUAtlas) Dirty() []image.Rectangle {
+	cells := make([]int, 0, len(a.dirty))
+	for cell := range a.dirty {
+		cells = append(cells, cell)
+	}
+	sort.Ints(cells)
+	rects := make([]image.Rectangle, len(cells))
+	for i, cell := range cells {
+		rects[i] = a.cell(cell)
+	}
+	a.dirty = map[int]bool{}
+	return rects
+}
@@ -0,0 +1,171 @@
+package fontloader
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+// newTestLRU creates an atlas of exactly columns by rows cells, preloading
+// text
+func newTestLRU(t *testing.T, columns, rows int, text string) *LRUAtlas {
+	t.Helper()
+	f := loadTestFont(t, "../../pragmono.ttf")
+	probe, err := f.LRUAtlas(LoadOptions{Text: "A", AtlasWidth: 256, AtlasHeight: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := f.LRUAtlas(LoadOptions{
+		Text:        text,
+		AtlasWidth:  probe.cellWidth * columns,
+		AtlasHeight: probe.cellHeight * rows,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Capacity() != columns*rows {
+		t.Fatalf("capacity %d, want %d", a.Capacity(), columns*rows)
+	}
+	return a
+}
+
+func mustGlyph(t *testing.T, a *LRUAtlas, r rune) Glyph {
+	t.Helper()
+	g, ok := a.Glyph(r)
+	if !ok {
+		t.Fatalf("no glyph for %q", r)
+	}
+	return g
+}
+
+func TestLRUCellSize(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	a, err := f.LRUAtlas(LoadOptions{AtlasWidth: 200, AtlasHeight: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The 16px font bounds are 89x18, plus rounding
+	if a.cellWidth != 91 || a.cellHeight != 20 {
+		t.Fatalf("cells are %dx%d, want 91x20", a.cellWidth, a.cellHeight)
+	}
+	if a.Capacity() != 6 {
+		t.Fatalf("capacity %d, want 6", a.Capacity())
+	}
+
+	// Runes outside the preloaded ones are rendered on demand, even those
+	// reaching far outside their advance
+	for _, r := range "‰Ω€⃝" {
+		g := mustGlyph(t, a, r)
+		if g.Width > a.cellWidth || g.Height > a.cellHeight {
+			t.Fatalf("%q is %dx%d in a %dx%d cell", r, g.Width, g.Height, a.cellWidth, a.cellHeight)
+		}
+	}
+	if _, ok := a.Glyph('\uE000'); ok {
+		t.Fatal("rune the font does not have was given a cell")
+	}
+}
+
+// A glyph too large for its cell is turned away without being remembered as
+// missing, so it is tried again
+func TestLRUOversized(t *testing.T) {
+	a := newTestLRU(t, 2, 1, "")
+	cellWidth := a.cellWidth
+	a.cellWidth = 4
+	if _, ok := a.Glyph('W'); ok {
+		t.Fatal("oversized glyph was given a cell")
+	}
+	if len(a.free) != a.Capacity() || a.missing['W'] {
+		t.Fatal("oversized glyph took a cell or was marked missing")
+	}
+	a.cellWidth = cellWidth
+	mustGlyph(t, a, 'W')
+}
+
+func TestLRUEviction(t *testing.T) {
+	a := newTestLRU(t, 2, 2, "ABCD")
+	cells := map[rune]Glyph{}
+	for _, r := range "ABCD" {
+		cells[r] = mustGlyph(t, a, r)
+	}
+
+	// A is used again, so B is the least recently used
+	a.Frame()
+	mustGlyph(t, a, 'A')
+	e := mustGlyph(t, a, 'E')
+	if e.X != cells['B'].X || e.Y != cells['B'].Y {
+		t.Fatalf("E placed at %d,%d, want the cell of B at %d,%d", e.X, e.Y, cells['B'].X, cells['B'].Y)
+	}
+	if _, ok := a.glyphs['B']; ok {
+		t.Fatal("B is still cached after eviction")
+	}
+
+	// Nothing used this frame is evicted
+	a.Frame()
+	for _, r := range "ACDE" {
+		mustGlyph(t, a, r)
+	}
+	if _, ok := a.Glyph('F'); ok {
+		t.Fatal("F evicted a glyph used this frame")
+	}
+
+	// Glyphs were used in the order A C D E, leaving A the oldest
+	a.Frame()
+	f := mustGlyph(t, a, 'F')
+	if f.X != cells['A'].X || f.Y != cells['A'].Y {
+		t.Fatalf("F placed at %d,%d, want the cell of A at %d,%d", f.X, f.Y, cells['A'].X, cells['A'].Y)
+	}
+
+	// Glyphs without ink take no cell
+	a.Frame()
+	for _, r := range "     " {
+		mustGlyph(t, a, r)
+	}
+	for _, r := range "CDEF" {
+		if _, ok := a.glyphs[r]; !ok {
+			t.Fatalf("%q evicted by a space", r)
+		}
+	}
+}
+
+func TestLRUDirty(t *testing.T) {
+	a := newTestLRU(t, 3, 2, "ABCD")
+	rect := func(g Glyph) image.Rectangle {
+		return image.Rect(g.X, g.Y, g.X+a.cellWidth, g.Y+a.cellHeight)
+	}
+
+	var want []image.Rectangle
+	for _, r := range "ABCD" {
+		want = append(want, rect(mustGlyph(t, a, r)))
+	}
+	if got := a.Dirty(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dirty %v after preloading, want %v", got, want)
+	}
+	if got := a.Dirty(); len(got) != 0 {
+		t.Fatalf("dirty %v after clearing", got)
+	}
+
+	// Lookups of cached glyphs change nothing
+	a.Frame()
+	mustGlyph(t, a, 'A')
+	mustGlyph(t, a, ' ')
+	if got := a.Dirty(); len(got) != 0 {
+		t.Fatalf("dirty %v without new glyphs", got)
+	}
+
+	// New glyphs are reported once each, in cell order
+	g := mustGlyph(t, a, 'G')
+	e := mustGlyph(t, a, 'E')
+	want = []image.Rectangle{rect(e), rect(g)}
+	if e.Y > g.Y || (e.Y == g.Y && e.X > g.X) {
+		want = []image.Rectangle{rect(g), rect(e)}
+	}
+	got := a.Dirty()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("dirty %v, want %v", got, want)
+	}
+	for _, d := range got {
+		if !d.In(a.Image.Bounds()) {
+			t.Fatalf("dirty %v outside the atlas", d)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package fontloader
+
+import (
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// VerticalMetrics places lines and decorations, in pixels at the size of the
+// charset. Distances are positive, measured from the baseline
+type VerticalMetrics struct {
+	// Ascent is the distance from the top of a line down to the baseline and
+	// Descent from the baseline down to the bottom
+	Ascent  float64 `json:"ascent"`
+	Descent float64 `json:"descent"`
+	// LineGap is the extra space the font asks for between lines
+	LineGap float64 `json:"lineGap"`
+	// LineHeight is the distance between baselines, ascent, descent and line
+	// gap together
+	LineHeight float64 `json:"lineHeight"`
+	CapHeight  float64 `json:"capHeight"`
+	XHeight    float64 `json:"xHeight"`
+	// UnderlinePosition is the distance from the baseline down to the top of
+	// an underline
+	UnderlinePosition  float64 `json:"underlinePosition"`
+	UnderlineThickness float64 `json:"underlineThickness"`
+}
+
+// Metrics returns the vertical metrics of the font at a size
+func (f *Font) Metrics(size, dpi float64) VerticalMetrics {
+	scale := fixed.Int26_6(0.5 + size*dpi*64/72)
+	return verticalMetrics(f.src, f.src.face(size, dpi, font.HintingNone), scale)
+}
+
+// verticalMetrics fills in what the font tables leave out from the glyphs of
+// face
+func verticalMetrics(src source, face font.Face, scale fixed.Int26_6) VerticalMetrics {
+	m := src.metrics(scale)
+	height := func(r rune) float64 {
+		b, _, ok := face.GlyphBounds(r)
+		if !ok {
+			return 0
+		}
+		return float64(-b.Min.Y) / 64
+	}
+	if m.CapHeight == 0 {
+		m.CapHeight = height('H')
+	}
+	if m.XHeight == 0 {
+		m.XHeight = height('x')
+	}
+	// Without a post table, use the common 1/20 em rule a tenth of an em down
+	em := float64(scale) / 64
+	if m.UnderlineThickness == 0 {
+		m.UnderlineThickness = em / 20
+		m.UnderlinePosition = em / 10
+	}
+	m.LineHeight = m.Ascent + m.Descent + m.LineGap
+	return m
+}
+
+// sfntMetrics reads the OS/2, hhea and post tables, leaving the line height
+// to verticalMetrics
+func sfntMetrics(f *sfnt.Font, buf *sfnt.Buffer, scale fixed.Int26_6) VerticalMetrics {
+	fm, err := f.Metrics(buf, scale, font.HintingNone)
+	if err != nil {
+		return VerticalMetrics{}
+	}
+	m := VerticalMetrics{
+		Ascent:  float64(fm.Ascent) / 64,
+		Descent: float64(fm.Descent) / 64,
+		LineGap: float64(fm.Height-fm.Ascent-fm.Descent) / 64,
+		// Heights taken from glyph tops for old OS/2 tables come out y down
+		CapHeight: math.Abs(float64(fm.CapHeight)) / 64,
+		XHeight:   math.Abs(float64(fm.XHeight)) / 64,
+	}
+	if post := f.PostTable(); post != nil && f.UnitsPerEm() > 0 {
+		units := float64(scale) / 64 / float64(f.UnitsPerEm())
+		m.UnderlinePosition = -float64(post.UnderlinePosition) * units
+		m.UnderlineThickness = float64(post.UnderlineThickness) * units
+	}
+	if m.LineGap < 0 {
+		m.LineGap = 0
+	}
+	return m
+}
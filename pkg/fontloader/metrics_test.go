@@ -0,0 +1,96 @@
+package fontloader
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestMetrics(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	m := f.Metrics(16, 72)
+	// pragmono has 2048 units to the em and its post table puts a 60 unit
+	// thick underline 305 units down
+	if m.UnderlinePosition != 305*16/2048.0 || m.UnderlineThickness != 60*16/2048.0 {
+		t.Fatalf("underline at %f, %f thick", m.UnderlinePosition, m.UnderlineThickness)
+	}
+	if m.LineHeight != m.Ascent+m.Descent+m.LineGap {
+		t.Fatalf("line height %f, want the sum of %+v", m.LineHeight, m)
+	}
+	if !(0 < m.XHeight && m.XHeight < m.CapHeight && m.CapHeight < m.Ascent && m.Descent > 0) {
+		t.Fatalf("metrics out of order: %+v", m)
+	}
+	if m2 := f.Metrics(8, 144); m2 != m {
+		t.Fatalf("metrics at twice the dpi are %+v, want %+v", m2, m)
+	}
+	// Metrics scale with the size, up to rounding to 1/64 pixel
+	m2 := f.Metrics(32, 72)
+	if math.Abs(m2.Ascent-2*m.Ascent) > 2.0/64 || math.Abs(m2.LineHeight-2*m.LineHeight) > 4.0/64 {
+		t.Fatalf("metrics at twice the size are %+v, want twice %+v", m2, m)
+	}
+
+	// Cap and x height match the glyphs they are measured on
+	c, err := f.Charset(LoadOptions{Text: "Hx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.VerticalMetrics != m {
+		t.Fatalf("charset metrics %+v, want %+v", c.VerticalMetrics, m)
+	}
+	for r, height := range map[rune]float64{'H': m.CapHeight, 'x': m.XHeight} {
+		if top := float64(c.Glyphs[r].Baseline); math.Abs(top-height) > 1 {
+			t.Fatalf("%q stands %f above the baseline, want %f", r, top, height)
+		}
+	}
+	loaded := roundTrip(t, c)
+	if loaded.VerticalMetrics != m {
+		t.Fatalf("loaded metrics %+v, want %+v", loaded.VerticalMetrics, m)
+	}
+
+	// Fallbacks are laid out on the lines of the primary font
+	chain, err := f.WithFallback(parseTestFont(t, goregular.TTF)).Charset(LoadOptions{Text: "Hx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.VerticalMetrics != m {
+		t.Fatalf("chain metrics %+v, want %+v", chain.VerticalMetrics, m)
+	}
+}
+
+// Fonts with an old OS/2 table have cap and x height measured on the glyphs,
+// and without an underline one is made up from the size
+func TestMetricsDerived(t *testing.T) {
+	tables, err := fontTables(goregular.TTF, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Version 1 ends before the cap and x height
+	os2 := patch(tables["OS/2"][:86], 0, 2, 1)
+	post := patch(tables["post"], 10, 2, 0)
+	f := parseTestFont(t, withTables(t, goregular.TTF, map[string][]byte{"OS/2": os2, "post": post}))
+	want := parseTestFont(t, goregular.TTF).Metrics(20, 72)
+
+	m := f.Metrics(20, 72)
+	if m.UnderlineThickness != 1 || m.UnderlinePosition != 2 {
+		t.Fatalf("underline at %f, %f thick, want a twentieth of an em a tenth down", m.UnderlinePosition, m.UnderlineThickness)
+	}
+	if math.Abs(m.CapHeight-want.CapHeight) > 1 || math.Abs(m.XHeight-want.XHeight) > 1 {
+		t.Fatalf("cap height %f and x height %f, want about %f and %f", m.CapHeight, m.XHeight, want.CapHeight, want.XHeight)
+	}
+	if m.Ascent != want.Ascent || m.LineHeight != want.LineHeight {
+		t.Fatalf("ascent %f and line height %f, want %f and %f", m.Ascent, m.LineHeight, want.Ascent, want.LineHeight)
+	}
+}
+
+// BMFont files only know the base and line height
+func TestMetricsBMFont(t *testing.T) {
+	c, err := LoadBMFont(filepath.Join("testdata", "bmfont", "hiero", "arial.fnt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.LineHeight == 0 || c.Ascent == 0 || c.Ascent+c.Descent != c.LineHeight {
+		t.Fatalf("metrics %+v, want ascent and descent adding up to the line height", c.VerticalMetrics)
+	}
+}
@@ -0,0 +1,73 @@
+package fontloader
+
+import (
+	"image"
+	"image/color"
+)
+
+// buildMipmaps renders the levels below every page
+func (c *Charset) buildMipmaps() {
+	c.Mipmaps = make([][]*image.RGBA, len(c.Pages))
+	for i := range c.Pages {
+		c.mipmap(i)
+	}
+}
+
+// mipmap renders the levels below a page. Glyphs are packed aligned to the
+// lowest level, so no texel mixes two glyphs and every glyph is filtered on
+// its own
+func (c *Charset) mipmap(page int) {
+	for len(c.Mipmaps) < len(c.Pages) {
+		c.Mipmaps = append(c.Mipmaps, nil)
+	}
+	levels := make([]*image.RGBA, c.MipLevels)
+	src := c.Pages[page]
+	for i := range levels {
+		levels[i] = downsample(src)
+		src = levels[i]
+	}
+	c.Mipmaps[page] = levels
+}
+
+// downsample halves img with a 2x2 box filter, weighting colors by alpha as
+// pages hold straight alpha. Odd sizes round up, the missing texels counting
+// as transparent
+func downsample(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	w, h := (b.Dx()+1)/2, (b.Dy()+1)/2
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, bl, a int
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					sx, sy := x*2+dx, y*2+dy
+					if sx >= b.Dx() || sy >= b.Dy() {
+						continue
+					}
+					c := img.RGBAAt(sx, sy)
+					r += int(c.R) * int(c.A)
+					g += int(c.G) * int(c.A)
+					bl += int(c.B) * int(c.A)
+					a += int(c.A)
+				}
+			}
+			if a == 0 {
+				continue
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + a/2) / a),
+				G: uint8((g + a/2) / a),
+				B: uint8((bl + a/2) / a),
+				A: uint8((a + 2) / 4),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,95 @@
+package fontloader
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDownsample(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	img.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+	img.SetRGBA(1, 0, color.RGBA{0, 0, 255, 255})
+	img.SetRGBA(2, 0, color.RGBA{0, 255, 0, 128})
+
+	got := downsample(img)
+	if got.Rect != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("downsampled to %v, want 2x1", got.Rect)
+	}
+	// Colors are weighted by alpha, the texels outside count as transparent
+	want := []color.RGBA{{128, 0, 128, 128}, {0, 255, 0, 32}}
+	for x, c := range want {
+		if got.RGBAAt(x, 0) != c {
+			t.Fatalf("texel %d is %v, want %v", x, got.RGBAAt(x, 0), c)
+		}
+	}
+}
+
+// footprint is the texels a glyph touches at a mip level
+func footprint(g Glyph, level int) image.Rectangle {
+	s := 1 << level
+	return image.Rect(g.X/s, g.Y/s, (g.X+g.Width+s-1)/s, (g.Y+g.Height+s-1)/s)
+}
+
+func TestMipLevels(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	const levels = 3
+	c, err := f.Charset(LoadOptions{Text: "abcdefgh", MipLevels: levels, Dynamic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLevels := func() {
+		t.Helper()
+		for i, page := range c.Pages {
+			if len(c.Mipmaps[i]) != levels {
+				t.Fatalf("page %d has %d levels, want %d", i, len(c.Mipmaps[i]), levels)
+			}
+			src := page
+			for _, level := range c.Mipmaps[i] {
+				want := downsample(src)
+				if level.Rect != want.Rect || string(level.Pix) != string(want.Pix) {
+					t.Fatalf("page %d level %v is not the one above downsampled", i, level.Rect)
+				}
+				src = level
+			}
+		}
+		// No texel of the lowest level mixes two glyphs, nor touches another
+		for a, ga := range c.Glyphs {
+			if ga.X%(1<<levels) != 0 || ga.Y%(1<<levels) != 0 {
+				t.Fatalf("glyph %q at %d,%d is not aligned", a, ga.X, ga.Y)
+			}
+			fa := footprint(ga, levels).Inset(-1)
+			for b, gb := range c.Glyphs {
+				if a != b && ga.Page == gb.Page && ga.Width > 0 && gb.Width > 0 && fa.Overlaps(footprint(gb, levels)) {
+					t.Fatalf("glyphs %q and %q meet at level %d", a, b, levels)
+				}
+			}
+		}
+	}
+	checkLevels()
+
+	// Glyphs added later are filtered into the levels too
+	if missing := c.Require("xyz"); len(missing) != 0 {
+		t.Fatalf("missing %q", missing)
+	}
+	checkLevels()
+
+	loaded := roundTrip(t, c)
+	for i := range c.Mipmaps {
+		for l, level := range c.Mipmaps[i] {
+			if string(loaded.Mipmaps[i][l].Pix) != string(level.Pix) {
+				t.Fatalf("loaded page %d level %d differs", i, l)
+			}
+		}
+	}
+
+	for name, opts := range map[string]LoadOptions{
+		"too many": {MipLevels: 13},
+		"negative": {MipLevels: -1},
+		"lcd":      {Mode: ModeLCD, MipLevels: 1},
+	} {
+		if _, err := f.Charset(opts); err == nil {
+			t.Fatalf("%s mip levels accepted", name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package fontloader
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// MultiCharset is a font rendered at several sizes into the same pages, so
+// all of them can be drawn from a single texture
+type MultiCharset struct {
+	Pages   []*image.RGBA
+	Mipmaps [][]*image.RGBA
+	// Charsets are sorted by size and share the pages, glyphs of every size
+	// refer to them
+	Charsets []*Charset
+}
+
+// MultiCharset renders the font at every size, opts.Size is ignored. The
+// charsets can not be dynamic as they share their pages
+func (f *Font) MultiCharset(opts LoadOptions, sizes ...float64) (*MultiCharset, error) {
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no sizes given")
+	}
+	sorted := append([]float64{}, sizes...)
+	sort.Float64s(sorted)
+	for i, size := range sorted {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid size %f", size)
+		}
+		if i > 0 && size == sorted[i-1] {
+			return nil, fmt.Errorf("size %f given twice", size)
+		}
+	}
+	if opts.Dynamic {
+		return nil, fmt.Errorf("multi size charsets can not be dynamic")
+	}
+	opts.Size = sorted[0]
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+
+	charsets, _, _, err := f.build(opts, sorted)
+	if err != nil {
+		return nil, err
+	}
+	return &MultiCharset{
+		Pages:    charsets[0].Pages,
+		Mipmaps:  charsets[0].Mipmaps,
+		Charsets: charsets,
+	}, nil
+}
+
+// Charset returns the smallest size at least as large as size, or the
+// largest one. Scaling a larger size down looks better than scaling up
+func (m *MultiCharset) Charset(size float64) *Charset {
+	for _, c := range m.Charsets {
+		if c.Size >= size {
+			return c
+		}
+	}
+	return m.Charsets[len(m.Charsets)-1]
+}
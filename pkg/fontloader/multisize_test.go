@@ -0,0 +1,83 @@
+package fontloader
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// glyphPix is the texels of a glyph, row by row
+func glyphPix(c *Charset, g Glyph) []byte {
+	page := c.Pages[g.Page]
+	var pix []byte
+	for y := g.Y; y < g.Y+g.Height; y++ {
+		i := page.PixOffset(g.X, y)
+		pix = append(pix, page.Pix[i:i+g.Width*4]...)
+	}
+	return pix
+}
+
+func TestMultiCharset(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	m, err := f.MultiCharset(LoadOptions{Text: "ag"}, 24, 12, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Charsets) != 3 {
+		t.Fatalf("got %d charsets, want 3", len(m.Charsets))
+	}
+
+	var rects []image.Rectangle
+	for i, size := range []float64{12, 16, 24} {
+		c := m.Charsets[i]
+		if c.Size != size || &c.Pages[0] != &m.Pages[0] {
+			t.Fatalf("charset %d is size %f with its own pages, want %f on the shared pages", i, c.Size, size)
+		}
+		// Every size is drawn as it would be on its own
+		single, err := f.Charset(LoadOptions{Text: "ag", Size: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.VerticalMetrics != single.VerticalMetrics {
+			t.Fatalf("size %f metrics %+v, want %+v", size, c.VerticalMetrics, single.VerticalMetrics)
+		}
+		for _, r := range "ag" {
+			g, want := c.Glyphs[r], single.Glyphs[r]
+			if g.Width != want.Width || g.Height != want.Height || g.Advance != want.Advance {
+				t.Fatalf("size %f glyph %q is %+v, want %+v", size, r, g, want)
+			}
+			if !bytes.Equal(glyphPix(c, g), glyphPix(single, want)) {
+				t.Fatalf("size %f glyph %q drawn differently", size, r)
+			}
+			rect := image.Rect(g.X, g.Y, g.X+g.Width, g.Y+g.Height)
+			for _, other := range rects {
+				if rect.Overlaps(other) {
+					t.Fatalf("size %f glyph %q at %v overlaps %v", size, r, rect, other)
+				}
+			}
+			rects = append(rects, rect)
+		}
+	}
+
+	lookups := map[float64]float64{1: 12, 12: 12, 14: 16, 20: 24, 100: 24}
+	for size, want := range lookups {
+		if got := m.Charset(size).Size; got != want {
+			t.Fatalf("size %f looked up %f, want %f", size, got, want)
+		}
+	}
+
+	invalid := map[string][]float64{
+		"no sizes":  nil,
+		"twice":     {12, 16, 12},
+		"negative":  {12, -1},
+		"zero size": {0},
+	}
+	for name, sizes := range invalid {
+		if _, err := f.MultiCharset(LoadOptions{Text: "ag"}, sizes...); err == nil {
+			t.Fatalf("%s accepted", name)
+		}
+	}
+	if _, err := f.MultiCharset(LoadOptions{Text: "ag", Dynamic: true}, 12, 16); err == nil {
+		t.Fatal("dynamic multi size charset accepted")
+	}
+}
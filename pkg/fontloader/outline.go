@@ -0,0 +1,113 @@
+package fontloader
+
+import (
+	"github.com/golang/freetype/truetype"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+// Curves are flattened into this many line pieces
+const curveSteps = 8
+
+// glyphShape converts the loaded glyph outline to an sdf.Shape in image
+// space, origin being the pen position on the baseline
+func glyphShape(buf *truetype.GlyphBuf, origin sdf.Vec2) sdf.Shape {
+	toVec := func(p truetype.Point) sdf.Vec2 {
+		return sdf.Vec2{
+			X: origin.X + float64(p.X)/64,
+			Y: origin.Y - float64(p.Y)/64,
+		}
+	}
+	mid := func(a, b sdf.Vec2) sdf.Vec2 {
+		return sdf.Vec2{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+	}
+
+	var shape sdf.Shape
+	start := 0
+	for _, end := range buf.Ends {
+		points := buf.Points[start:end]
+		start = end
+		if len(points) < 2 {
+			continue
+		}
+
+		// Start on the curve, using the implied midpoint if no point is
+		first := -1
+		for i, p := range points {
+			if p.Flags&0x01 != 0 {
+				first = i
+				break
+			}
+		}
+		var startPt sdf.Vec2
+		if first < 0 {
+			startPt = mid(toVec(points[0]), toVec(points[1]))
+			first = 1
+		} else {
+			startPt = toVec(points[first])
+			first++
+		}
+
+		var contour sdf.Contour
+		curr := startPt
+		var ctrl *sdf.Vec2
+		for n := 0; n < len(points); n++ {
+			p := points[(first+n)%len(points)]
+			v := toVec(p)
+			onCurve := p.Flags&0x01 != 0
+
+			switch {
+			case onCurve && ctrl == nil:
+				contour = append(contour, sdf.Edge{Points: []sdf.Vec2{curr, v}})
+				curr = v
+			case onCurve:
+				contour = append(contour, quadEdge(curr, *ctrl, v))
+				curr = v
+				ctrl = nil
+			case ctrl != nil:
+				m := mid(*ctrl, v)
+				contour = append(contour, quadEdge(curr, *ctrl, m))
+				curr = m
+				c := v
+				ctrl = &c
+			default:
+				c := v
+				ctrl = &c
+			}
+		}
+		if ctrl != nil {
+			contour = append(contour, quadEdge(curr, *ctrl, startPt))
+		} else if curr != startPt {
+			contour = append(contour, sdf.Edge{Points: []sdf.Vec2{curr, startPt}})
+		}
+
+		shape = append(shape, contour)
+	}
+	return shape
+}
+
+func quadEdge(a, b, c sdf.Vec2) sdf.Edge {
+	pts := make([]sdf.Vec2, curveSteps+1)
+	for i := 0; i <= curveSteps; i++ {
+		t := float64(i) / curveSteps
+		u := 1 - t
+		pts[i] = sdf.Vec2{
+			X: u*u*a.X + 2*u*t*b.X + t*t*c.X,
+			Y: u*u*a.Y + 2*u*t*b.Y + t*t*c.Y,
+		}
+	}
+	return sdf.Edge{Points: pts}
+}
+
+func cubicEdge(a, b, c, d sdf.Vec2) sdf.Edge {
+	pts := make([]sdf.Vec2, curveSteps+1)
+	for i := 0; i <= curveSteps; i++ {
+		t := float64(i) / curveSteps
+		u := 1 - t
+		pts[i] = sdf.Vec2{
+			X: u*u*u*a.X + 3*u*u*t*b.X + 3*u*t*t*c.X + t*t*t*d.X,
+			Y: u*u*u*a.Y + 3*u*u*t*b.Y + 3*u*t*t*c.Y + t*t*t*d.Y,
+		}
+	}
+	return sdf.Edge{Points: pts}
+}
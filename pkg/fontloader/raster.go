@@ -0,0 +1,260 @@
+package fontloader
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+// rasterizer renders single glyphs into their own images
+type rasterizer struct {
+	src     source
+	opts    LoadOptions
+	scale   fixed.Int26_6
+	face    font.Face
+	metrics font.Metrics
+
+	// hiFace renders coverage at oversample times the size, it is face
+	// unless in sdf or lcd mode
+	hiFace     font.Face
+	oversample int
+
+	cellWidth, cellHeight int
+}
+
+func newRasterizer(src source, opts LoadOptions) *rasterizer {
+	r := &rasterizer{
+		src:   src,
+		opts:  opts,
+		scale: fixed.Int26_6(0.5 + opts.Size*opts.DPI*64/72),
+		face:  src.face(opts.Size, opts.DPI, opts.Hinting),
+	}
+	r.metrics = r.face.Metrics()
+	r.hiFace, r.oversample = r.face, 1
+	if opts.Mode == ModeSDF {
+		r.oversample = opts.SDFOversample
+		r.hiFace = src.face(opts.Size*float64(opts.SDFOversample), opts.DPI, opts.Hinting)
+	}
+	// Every pixel is three subpixels wide, and as many tall to antialias
+	// vertically
+	if opts.Mode == ModeLCD {
+		r.oversample = 3
+		r.hiFace = src.face(opts.Size*3, opts.DPI, opts.Hinting)
+	}
+
+	if opts.CellWidth > 0 || opts.CellHeight > 0 {
+		bounds := src.bounds(r.scale)
+		r.cellWidth, r.cellHeight = opts.CellWidth, opts.CellHeight
+		if r.cellWidth == 0 {
+			r.cellWidth = bounds.Max.X.Ceil() - bounds.Min.X.Floor()
+		}
+		if r.cellHeight == 0 {
+			r.cellHeight = (r.metrics.Ascent + r.metrics.Descent).Ceil()
+		}
+	}
+	return r
+}
+
+// render draws a glyph into an image of its own, the returned glyph has
+// everything but its atlas position filled in. Glyphs without ink have no
+// image
+func (r *rasterizer) render(ru rune) (*image.RGBA, Glyph, error) {
+	g := Glyph{
+		Rune:    ru,
+		Advance: float64(r.src.advance(r.scale, ru)) / 64,
+	}
+
+	// Color glyphs are drawn as they are, distance fields have no color
+	var colored *image.NRGBA
+	var at image.Point
+	if r.opts.Mode == ModeBitmap {
+		colored, at, g.Color = r.src.color(r.scale, ru)
+	}
+
+	// The ink in output pixels, covering all of the oversampled ink
+	var minX, minY, maxX, maxY int
+	var empty bool
+	if g.Color {
+		minX, minY = at.X, at.Y
+		maxX, maxY = at.X+colored.Bounds().Dx(), at.Y+colored.Bounds().Dy()
+	} else {
+		bounds, _, ok := r.hiFace.GlyphBounds(ru)
+		empty = !ok || bounds.Max.X <= bounds.Min.X || bounds.Max.Y <= bounds.Min.Y
+		unit := float64(r.oversample) * 64
+		minX = int(math.Floor(float64(bounds.Min.X) / unit))
+		minY = int(math.Floor(float64(bounds.Min.Y) / unit))
+		maxX = int(math.Ceil(float64(bounds.Max.X) / unit))
+		maxY = int(math.Ceil(float64(bounds.Max.Y) / unit))
+	}
+	// The lcd filter spreads ink sideways
+	if r.opts.Mode == ModeLCD && !empty {
+		spread := (len(r.opts.LCDFilter)/2 + 2) / 3
+		minX -= spread
+		maxX += spread
+	}
+	if empty && r.cellWidth == 0 {
+		return nil, g, nil
+	}
+	if empty {
+		minX = 0
+	}
+
+	// Effects reach outside the ink, on top of the padding
+	pad := r.opts.Padding
+	m := effectMargins(r.opts.Effects)
+	dotX := pad + m[0] - minX
+	var dotY, width, height int
+	if r.cellWidth > 0 {
+		dotY = pad + m[1] + r.metrics.Ascent.Round()
+		width = r.cellWidth + pad*2 + m[0] + m[2]
+		height = r.cellHeight + pad*2 + m[1] + m[3]
+	} else {
+		dotY = pad + m[1] - minY
+		width = maxX - minX + pad*2 + m[0] + m[2]
+		height = maxY - minY + pad*2 + m[1] + m[3]
+	}
+	g.Width, g.Height = width, height
+	g.Bearing = -dotX
+	g.Baseline = dotY
+
+	coverage := image.NewGray(image.Rect(0, 0, width*r.oversample, height*r.oversample))
+	if g.Color {
+		for y := 0; y < colored.Bounds().Dy(); y++ {
+			for x := 0; x < colored.Bounds().Dx(); x++ {
+				coverage.SetGray(dotX+at.X+x, dotY+at.Y+y, color.Gray{Y: colored.NRGBAAt(x, y).A})
+			}
+		}
+	} else if !empty {
+		dot := fixed.P(dotX*r.oversample, dotY*r.oversample)
+		dr, mask, maskp, _, ok := r.hiFace.Glyph(dot, ru)
+		if ok {
+			draw.DrawMask(coverage, dr, image.White, image.ZP, mask, maskp, draw.Over)
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	switch r.opts.Mode {
+	case ModeBitmap:
+		canvas := image.NewNRGBA(img.Bounds())
+		if g.Color {
+			draw.Draw(canvas, colored.Bounds().Add(image.Pt(dotX+at.X, dotY+at.Y)), colored, image.ZP, draw.Src)
+		} else {
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					canvas.SetNRGBA(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: coverage.GrayAt(x, y).Y})
+				}
+			}
+		}
+		for _, e := range r.opts.Effects {
+			e.apply(canvas, coverage)
+		}
+		// Pages hold straight alpha like the rest of the atlas
+		copy(img.Pix, canvas.Pix)
+
+	case ModeSDF:
+		field, err := sdf.GenerateWithOptions(coverage, sdf.Options{
+			Spread:    float64(pad),
+			Threshold: 127,
+			Scale:     r.oversample,
+		})
+		if err != nil {
+			return nil, g, fmt.Errorf("could not generate sdf for %q: %w", ru, err)
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				v := field.(*image.Gray).GrayAt(x, y).Y
+				img.SetRGBA(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+			}
+		}
+
+	case ModeMSDF:
+		shape, err := r.src.shape(r.scale, r.opts.Hinting, ru, sdf.Vec2{X: float64(dotX), Y: float64(dotY)})
+		if err != nil {
+			return nil, g, fmt.Errorf("could not load glyph %q: %w", ru, err)
+		}
+		draw.Draw(img, img.Bounds(), sdf.GenerateMSDF(shape, width, height, float64(pad)), image.ZP, draw.Src)
+
+	case ModeLCD:
+		lcdFilter(img, coverage, r.opts.LCDFilter)
+	}
+
+	return img, g, nil
+}
+
+// lcdFilter turns coverage at three times the size into the coverage of
+// every subpixel of img. Rows are averaged, columns are the subpixels and run
+// through the filter
+func lcdFilter(img *image.RGBA, coverage *image.Gray, filter []float64) {
+	b := coverage.Bounds()
+	row := make([]float64, b.Dx())
+	half := len(filter) / 2
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := range row {
+			row[x] = 0
+			for i := 0; i < 3; i++ {
+				row[x] += float64(coverage.GrayAt(x, y*3+i).Y) / 3
+			}
+		}
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			var c [3]uint8
+			for s := range c {
+				var v float64
+				for i, w := range filter {
+					if sx := x*3 + s + i - half; sx >= 0 && sx < len(row) {
+						v += w * row[sx]
+					}
+				}
+				c[s] = uint8(math.Min(255, v+0.5))
+			}
+			a := c[0]
+			if c[1] > a {
+				a = c[1]
+			}
+			if c[2] > a {
+				a = c[2]
+			}
+			img.SetRGBA(x, y, color.RGBA{R: c[0], G: c[1], B: c[2], A: a})
+		}
+	}
+}
+
+// renderAll renders runes on opts.Workers goroutines, each with a rasterizer
+// of its own as faces and sources can not be shared. The results are in the
+// order of runes
+func renderAll(src source, opts LoadOptions, runes []rune) ([]*image.RGBA, []Glyph, error) {
+	imgs := make([]*image.RGBA, len(runes))
+	glyphs := make([]Glyph, len(runes))
+	errs := make([]error, len(runes))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers && w < len(runes); w++ {
+		wg.Add(1)
+		go func(rast *rasterizer) {
+			defer wg.Done()
+			for i := range next {
+				imgs[i], glyphs[i], errs[i] = rast.render(runes[i])
+			}
+		}(newRasterizer(src.clone(), opts))
+	}
+	for i := range runes {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return imgs, glyphs, nil
+}
@@ -0,0 +1,43 @@
+package fontloader
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Rendering on one worker or many gives the same atlas
+func TestRenderWorkers(t *testing.T) {
+	f := testKernFont(t)
+	modes := []Mode{ModeBitmap, ModeSDF, ModeMSDF, ModeLCD}
+	for _, mode := range modes {
+		t.Run(string(mode), func(t *testing.T) {
+			opts := LoadOptions{Mode: mode, Padding: 2, Ranges: []RuneRange{{First: 32, Last: 383}}}
+			opts.Workers = 1
+			serial, err := f.Charset(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.Workers = 8
+			parallel, err := f.Charset(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(serial.Pages) != len(parallel.Pages) {
+				t.Fatalf("%d pages on one worker, %d on eight", len(serial.Pages), len(parallel.Pages))
+			}
+			for i, p := range serial.Pages {
+				if p.Rect != parallel.Pages[i].Rect || !bytes.Equal(p.Pix, parallel.Pages[i].Pix) {
+					t.Fatalf("page %d differs between one worker and eight", i)
+				}
+			}
+			if !reflect.DeepEqual(serial.Glyphs, parallel.Glyphs) {
+				t.Fatal("glyphs differ between one worker and eight")
+			}
+			if len(serial.Kerning) == 0 || !reflect.DeepEqual(serial.Kerning, parallel.Kerning) {
+				t.Fatal("kerning differs between one worker and eight")
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package fontloader
+
+import (
+	"image"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+// sfntSource reads OpenType fonts with CFF or TrueType outlines and
+// collections, without hinting
+type sfntSource struct {
+	f      *sfnt.Font
+	buf    sfnt.Buffer
+	colors *colorTables
+}
+
+func (s *sfntSource) clone() source {
+	return &sfntSource{f: s.f, colors: s.colors}
+}
+
+func (s *sfntSource) index(r rune) int {
+	i, err := s.f.GlyphIndex(&s.buf, r)
+	if err != nil {
+		return 0
+	}
+	return int(i)
+}
+
+func (s *sfntSource) glyphs() int {
+	return s.f.NumGlyphs()
+}
+
+func (s *sfntSource) face(size, dpi float64, hinting font.Hinting) font.Face {
+	return &sfntFace{
+		f:       s.f,
+		scale:   fixed.Int26_6(0.5 + size*dpi*64/72),
+		hinting: hinting,
+	}
+}
+
+func (s *sfntSource) bounds(scale fixed.Int26_6) fixed.Rectangle26_6 {
+	b, _ := s.f.Bounds(&s.buf, scale, font.HintingNone)
+	return b
+}
+
+func (s *sfntSource) advance(scale fixed.Int26_6, r rune) fixed.Int26_6 {
+	a, _ := s.f.GlyphAdvance(&s.buf, sfnt.GlyphIndex(s.index(r)), scale, font.HintingNone)
+	return a
+}
+
+func (s *sfntSource) color(scale fixed.Int26_6, r rune) (*image.NRGBA, image.Point, bool) {
+	return s.colors.draw(s.f, &s.buf, scale, sfnt.GlyphIndex(s.index(r)))
+}
+
+func (s *sfntSource) metrics(scale fixed.Int26_6) VerticalMetrics {
+	return sfntMetrics(s.f, &s.buf, scale)
+}
+
+// hasKern is always true, sfnt reads both kern and GPOS tables and reports
+// missing pairs as errors
+func (s *sfntSource) hasKern() bool {
+	return true
+}
+
+func (s *sfntSource) kern(scale fixed.Int26_6, left, right int) fixed.Int26_6 {
+	k, err := s.f.Kern(&s.buf, sfnt.GlyphIndex(left), sfnt.GlyphIndex(right), scale, font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return k
+}
+
+func (s *sfntSource) shape(scale fixed.Int26_6, hinting font.Hinting, r rune, origin sdf.Vec2) (sdf.Shape, error) {
+	segments, err := s.f.LoadGlyph(&s.buf, sfnt.GlyphIndex(s.index(r)), scale, nil)
+	if err != nil {
+		return nil, err
+	}
+	return segmentShape(segments, origin), nil
+}
+
+// segmentShape converts sfnt segments, which already have y growing
+// downwards, to an sdf.Shape
+func segmentShape(segments []sfnt.Segment, origin sdf.Vec2) sdf.Shape {
+	toVec := func(p fixed.Point26_6) sdf.Vec2 {
+		return sdf.Vec2{
+			X: origin.X + float64(p.X)/64,
+			Y: origin.Y + float64(p.Y)/64,
+		}
+	}
+
+	var shape sdf.Shape
+	var contour sdf.Contour
+	var start, curr sdf.Vec2
+	closeContour := func() {
+		if curr != start {
+			contour = append(contour, sdf.Edge{Points: []sdf.Vec2{curr, start}})
+		}
+		if len(contour) > 0 {
+			shape = append(shape, contour)
+		}
+		contour = nil
+	}
+	for _, seg := range segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			closeContour()
+			start = toVec(seg.Args[0])
+			curr = start
+		case sfnt.SegmentOpLineTo:
+			p := toVec(seg.Args[0])
+			contour = append(contour, sdf.Edge{Points: []sdf.Vec2{curr, p}})
+			curr = p
+		case sfnt.SegmentOpQuadTo:
+			p := toVec(seg.Args[1])
+			contour = append(contour, quadEdge(curr, toVec(seg.Args[0]), p))
+			curr = p
+		case sfnt.SegmentOpCubeTo:
+			p := toVec(seg.Args[2])
+			contour = append(contour, cubicEdge(curr, toVec(seg.Args[0]), toVec(seg.Args[1]), p))
+			curr = p
+		}
+	}
+	closeContour()
+	return shape
+}
+
+// sfntFace is a font.Face for sfnt fonts, the opentype package does not
+// rasterise glyphs yet
+type sfntFace struct {
+	f       *sfnt.Font
+	scale   fixed.Int26_6
+	hinting font.Hinting
+	buf     sfnt.Buffer
+	raster  vector.Rasterizer
+}
+
+func (f *sfntFace) Close() error {
+	return nil
+}
+
+func (f *sfntFace) Metrics() font.Metrics {
+	m, _ := f.f.Metrics(&f.buf, f.scale, f.hinting)
+	return m
+}
+
+func (f *sfntFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	x0, _ := f.f.GlyphIndex(&f.buf, r0)
+	x1, _ := f.f.GlyphIndex(&f.buf, r1)
+	k, err := f.f.Kern(&f.buf, x0, x1, f.scale, f.hinting)
+	if err != nil {
+		return 0
+	}
+	return k
+}
+
+func (f *sfntFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	x, _ := f.f.GlyphIndex(&f.buf, r)
+	advance, err := f.f.GlyphAdvance(&f.buf, x, f.scale, f.hinting)
+	return advance, err == nil
+}
+
+// GlyphBounds uses the control points, which always contain the outline
+func (f *sfntFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	advance, ok := f.GlyphAdvance(r)
+	if !ok {
+		return fixed.Rectangle26_6{}, advance, false
+	}
+	x, _ := f.f.GlyphIndex(&f.buf, r)
+	segments, err := f.f.LoadGlyph(&f.buf, x, f.scale, nil)
+	if err != nil {
+		return fixed.Rectangle26_6{}, advance, false
+	}
+	return segmentBounds(segments), advance, true
+}
+
+func (f *sfntFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	advance, ok := f.GlyphAdvance(r)
+	if !ok {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	x, _ := f.f.GlyphIndex(&f.buf, r)
+	dr, mask, ok := glyphMask(f.f, &f.buf, &f.raster, f.scale, x, dot)
+	if !ok {
+		return image.Rectangle{}, nil, image.Point{}, 0, false
+	}
+	return dr, mask, image.Point{}, advance, true
+}
+
+// segmentBounds is the box around all control points
+func segmentBounds(segments []sfnt.Segment) fixed.Rectangle26_6 {
+	var bounds fixed.Rectangle26_6
+	for i, seg := range segments {
+		n := 1
+		switch seg.Op {
+		case sfnt.SegmentOpQuadTo:
+			n = 2
+		case sfnt.SegmentOpCubeTo:
+			n = 3
+		}
+		for j, p := range seg.Args[:n] {
+			if i == 0 && j == 0 {
+				bounds = fixed.Rectangle26_6{Min: p, Max: p}
+				continue
+			}
+			if p.X < bounds.Min.X {
+				bounds.Min.X = p.X
+			}
+			if p.Y < bounds.Min.Y {
+				bounds.Min.Y = p.Y
+			}
+			if p.X > bounds.Max.X {
+				bounds.Max.X = p.X
+			}
+			if p.Y > bounds.Max.Y {
+				bounds.Max.Y = p.Y
+			}
+		}
+	}
+	return bounds
+}
+
+// glyphMask rasterises a glyph by index with the pen at dot, the mask
+// covering the returned rectangle
+func glyphMask(f *sfnt.Font, buf *sfnt.Buffer, raster *vector.Rasterizer, scale fixed.Int26_6, x sfnt.GlyphIndex, dot fixed.Point26_6) (image.Rectangle, *image.Alpha, bool) {
+	segments, err := f.LoadGlyph(buf, x, scale, nil)
+	if err != nil {
+		return image.Rectangle{}, nil, false
+	}
+	bounds := segmentBounds(segments).Add(dot)
+	dr := image.Rect(bounds.Min.X.Floor(), bounds.Min.Y.Floor(), bounds.Max.X.Ceil(), bounds.Max.Y.Ceil())
+	mask := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	if dr.Empty() {
+		return dr, mask, true
+	}
+
+	// Segments are relative to the dot, the mask to the top left of dr
+	offX := float32(dot.X)/64 - float32(dr.Min.X)
+	offY := float32(dot.Y)/64 - float32(dr.Min.Y)
+	pt := func(p fixed.Point26_6) (float32, float32) {
+		return float32(p.X)/64 + offX, float32(p.Y)/64 + offY
+	}
+	raster.Reset(dr.Dx(), dr.Dy())
+	for _, seg := range segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			raster.MoveTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			raster.LineTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			bx, by := pt(seg.Args[0])
+			cx, cy := pt(seg.Args[1])
+			raster.QuadTo(bx, by, cx, cy)
+		case sfnt.SegmentOpCubeTo:
+			bx, by := pt(seg.Args[0])
+			cx, cy := pt(seg.Args[1])
+			dx, dy := pt(seg.Args[2])
+			raster.CubeTo(bx, by, cx, cy, dx, dy)
+		}
+	}
+	raster.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	return dr, mask, true
+}
+
+// isTrueType reports whether data is a single font with TrueType outlines,
+// the only kind freetype reads
+func isTrueType(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	tag := string(data[:4])
+	return tag == "\x00\x01\x00\x00" || tag == "true"
+}
@@ -0,0 +1,147 @@
+package fontloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// MetricsVersion is bumped whenever the metrics change meaning, sidecars of
+// other versions are refused by LoadCharset
+const MetricsVersion = 2
+
+// Errors returned by LoadCharset for atlases that should be rebuilt
+var (
+	ErrVersion  = errors.New("charset metrics version mismatch")
+	ErrChecksum = errors.New("charset page checksum mismatch")
+)
+
+type pageInfo struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	File   string `json:"file,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type charsetJSON Charset
+
+type sidecar struct {
+	Version int        `json:"version"`
+	Pages   []pageInfo `json:"pages"`
+	*charsetJSON
+}
+
+// sidecar describes the charset, files holds the saved page files and their
+// checksums if any
+func (c *Charset) sidecar(files []pageInfo) sidecar {
+	pages := files
+	if pages == nil {
+		pages = make([]pageInfo, len(c.Pages))
+		for i, p := range c.Pages {
+			pages[i] = pageInfo{Width: p.Bounds().Dx(), Height: p.Bounds().Dy()}
+		}
+	}
+	return sidecar{
+		Version:     MetricsVersion,
+		Pages:       pages,
+		charsetJSON: (*charsetJSON)(c),
+	}
+}
+
+// MetricsPath returns the sidecar Save writes next to the first page
+func MetricsPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+// Save writes every page as png, see PagePath, and the metrics with page
+// checksums to the sidecar at MetricsPath
+func (c *Charset) Save(path string) error {
+	files := make([]pageInfo, len(c.Pages))
+	for i, p := range c.Pages {
+		var buf bytes.Buffer
+		if err := encodePNG(&buf, p); err != nil {
+			return fmt.Errorf("could not png encode \"%s\": %w", PagePath(path, i), err)
+		}
+		if err := ioutil.WriteFile(PagePath(path, i), buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("could not write file \"%s\": %w", PagePath(path, i), err)
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		files[i] = pageInfo{
+			Width:  p.Bounds().Dx(),
+			Height: p.Bounds().Dy(),
+			File:   filepath.Base(PagePath(path, i)),
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+	}
+
+	metricsPath := MetricsPath(path)
+	data, err := json.MarshalIndent(c.sidecar(files), "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not json encode \"%s\": %w", metricsPath, err)
+	}
+	if err := ioutil.WriteFile(metricsPath, data, 0644); err != nil {
+		return fmt.Errorf("could not write file \"%s\": %w", metricsPath, err)
+	}
+	return nil
+}
+
+// LoadCharset restores a charset written by Save, path being the same path
+// given to Save. The result is not dynamic
+func LoadCharset(path string) (*Charset, error) {
+	metricsPath := MetricsPath(path)
+	data, err := ioutil.ReadFile(metricsPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file \"%s\": %w", metricsPath, err)
+	}
+
+	c := &Charset{}
+	meta := c.sidecar(nil)
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("could not parse \"%s\": %w", metricsPath, err)
+	}
+	if meta.Version != MetricsVersion {
+		return nil, fmt.Errorf("\"%s\" has version %d, expected %d: %w", metricsPath, meta.Version, MetricsVersion, ErrVersion)
+	}
+	if len(meta.Pages) == 0 {
+		return nil, fmt.Errorf("\"%s\" has no pages", metricsPath)
+	}
+
+	dir := filepath.Dir(metricsPath)
+	c.Pages = nil
+	for i, p := range meta.Pages {
+		if p.File == "" || p.SHA256 == "" {
+			return nil, fmt.Errorf("\"%s\" has no file for page %d, it was not written by Save", metricsPath, i)
+		}
+		pagePath := filepath.Join(dir, p.File)
+		pageData, err := ioutil.ReadFile(pagePath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file \"%s\": %w", pagePath, err)
+		}
+		sum := sha256.Sum256(pageData)
+		if hex.EncodeToString(sum[:]) != p.SHA256 {
+			return nil, fmt.Errorf("\"%s\": %w", pagePath, ErrChecksum)
+		}
+		img, err := decodePNG(bytes.NewReader(pageData))
+		if err != nil {
+			return nil, fmt.Errorf("could not png decode \"%s\": %w", pagePath, err)
+		}
+		if img.Bounds().Dx() != p.Width || img.Bounds().Dy() != p.Height {
+			return nil, fmt.Errorf("\"%s\" is %dx%d, expected %dx%d", pagePath, img.Bounds().Dx(), img.Bounds().Dy(), p.Width, p.Height)
+		}
+		c.Pages = append(c.Pages, img)
+	}
+	c.Image = c.Pages[0]
+	if c.MipLevels > 0 {
+		c.buildMipmaps()
+	}
+	if c.Glyphs == nil {
+		c.Glyphs = map[rune]Glyph{}
+	}
+	return c, nil
+}
@@ -0,0 +1,141 @@
+package fontloader
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func loadTestFont(t *testing.T, path string) *Font {
+	t.Helper()
+	f, err := LoadFont(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// roundTrip saves and loads c, failing unless the pages come back byte for
+// byte
+func roundTrip(t *testing.T, c *Charset) *Charset {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "atlas.png")
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCharset(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Pages) != len(c.Pages) {
+		t.Fatalf("loaded %d pages, saved %d", len(loaded.Pages), len(c.Pages))
+	}
+	for i, p := range c.Pages {
+		l := loaded.Pages[i]
+		if l.Rect != p.Rect {
+			t.Fatalf("page %d loaded as %v, saved %v", i, l.Rect, p.Rect)
+		}
+		if !bytes.Equal(l.Pix, p.Pix) {
+			var diff int
+			for j := range p.Pix {
+				if l.Pix[j] != p.Pix[j] {
+					diff++
+				}
+			}
+			t.Fatalf("page %d differs in %d bytes", i, diff)
+		}
+	}
+	if len(loaded.Glyphs) != len(c.Glyphs) {
+		t.Fatalf("loaded %d glyphs, saved %d", len(loaded.Glyphs), len(c.Glyphs))
+	}
+	for r, g := range c.Glyphs {
+		if loaded.Glyphs[r] != g {
+			t.Fatalf("glyph %q loaded as %+v, saved %+v", r, loaded.Glyphs[r], g)
+		}
+	}
+	return loaded
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	tests := []struct {
+		name string
+		opts LoadOptions
+	}{
+		{"bitmap", LoadOptions{}},
+		{"bitmap pages", LoadOptions{Size: 32, AtlasWidth: 128, AtlasHeight: 128}},
+		{"sdf", LoadOptions{Mode: ModeSDF, Padding: 4}},
+		{"msdf", LoadOptions{Mode: ModeMSDF, Padding: 4}},
+		// Effect layers are translucent colors in straight alpha
+		{"effects", LoadOptions{Size: 24, Effects: []Effect{
+			Gradient{Top: color.NRGBA{255, 255, 0, 255}, Bottom: color.NRGBA{255, 0, 0, 200}},
+			InnerGlow{Radius: 2, Color: color.NRGBA{255, 255, 255, 96}},
+			Outline{Width: 1.5, Color: color.NRGBA{0, 0, 128, 160}},
+			DropShadow{OffsetX: 2, OffsetY: 2, Blur: 2, Color: color.NRGBA{0, 0, 0, 128}},
+		}}},
+		{"lcd", LoadOptions{Mode: ModeLCD}},
+		{"lcd light", LoadOptions{Size: 11, Mode: ModeLCD, LCDFilter: LCDFilterLight}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := f.Charset(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded := roundTrip(t, c)
+			if loaded.Mode != c.Mode || loaded.Spread != c.Spread {
+				t.Fatalf("loaded mode %s spread %f, saved %s %f", loaded.Mode, loaded.Spread, c.Mode, c.Spread)
+			}
+		})
+	}
+}
+
+// Pages hold straight alpha, translucent colors must not be scaled by alpha
+// on the way out
+func TestSaveStraightAlpha(t *testing.T) {
+	page := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	for i, c := range []color.RGBA{{128, 0, 0, 64}, {255, 255, 255, 1}, {10, 20, 30, 0}, {255, 128, 0, 255}} {
+		page.SetRGBA(i, 0, c)
+	}
+	c := &Charset{
+		Image:  page,
+		Pages:  []*image.RGBA{page},
+		Mode:   ModeBitmap,
+		Glyphs: map[rune]Glyph{'a': {Rune: 'a', Width: 4, Height: 1}},
+	}
+	roundTrip(t, c)
+}
+
+// LCD pages hold the coverage of each subpixel with alpha the largest, none
+// of it may be scaled by alpha when saved
+func TestSaveLCD(t *testing.T) {
+	f := loadTestFont(t, "../../pragmono.ttf")
+	c, err := f.Charset(LoadOptions{Mode: ModeLCD, Text: "Wave"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fringes int
+	pix := c.Pages[0].Pix
+	for i := 0; i < len(pix); i += 4 {
+		r, g, b, a := pix[i], pix[i+1], pix[i+2], pix[i+3]
+		max := r
+		if g > max {
+			max = g
+		}
+		if b > max {
+			max = b
+		}
+		if a != max {
+			t.Fatalf("texel %d is %v, alpha is not the largest channel", i/4, pix[i:i+4])
+		}
+		if a > 0 && a < 255 && (r != g || g != b) {
+			fringes++
+		}
+	}
+	if fringes == 0 {
+		t.Fatal("no translucent texels with subpixel coverage")
+	}
+	roundTrip(t, c)
+}
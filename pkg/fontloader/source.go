@@ -0,0 +1,114 @@
+package fontloader
+
+import (
+	"image"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/perlw/sandbox_go/pkg/sdf"
+)
+
+// source is a parsed font of either flavour, scale is pixels per em in 26.6.
+// Sources are not safe for concurrent use, clone them instead
+type source interface {
+	// clone shares the parsed font but nothing that changes on use
+	clone() source
+	// index is the glyph for a rune, 0 if the font has none
+	index(r rune) int
+	// glyphs is the number of glyphs in the font
+	glyphs() int
+	face(size, dpi float64, hinting font.Hinting) font.Face
+	// bounds is the union of all glyph bounds
+	bounds(scale fixed.Int26_6) fixed.Rectangle26_6
+	advance(scale fixed.Int26_6, r rune) fixed.Int26_6
+	// color renders a color glyph, returning where its top left is relative
+	// to the pen, false for glyphs that are only an outline
+	color(scale fixed.Int26_6, r rune) (*image.NRGBA, image.Point, bool)
+	// metrics are the vertical metrics from the font tables
+	metrics(scale fixed.Int26_6) VerticalMetrics
+	hasKern() bool
+	kern(scale fixed.Int26_6, left, right int) fixed.Int26_6
+	// shape is the glyph outline in image space, origin being the pen
+	// position on the baseline
+	shape(scale fixed.Int26_6, hinting font.Hinting, r rune, origin sdf.Vec2) (sdf.Shape, error)
+}
+
+// truetypeSource uses freetype, which has hinting but only reads TrueType
+// outlines
+type truetypeSource struct {
+	ft      *truetype.Font
+	kerning bool
+	// sf reads the tables freetype skips, nil if sfnt could not parse the font
+	sf     *sfnt.Font
+	buf    sfnt.Buffer
+	colors *colorTables
+}
+
+func (s *truetypeSource) clone() source {
+	return &truetypeSource{ft: s.ft, kerning: s.kerning, sf: s.sf, colors: s.colors}
+}
+
+func (s *truetypeSource) index(r rune) int {
+	return int(s.ft.Index(r))
+}
+
+func (s *truetypeSource) glyphs() int {
+	if s.sf == nil {
+		return 0
+	}
+	return s.sf.NumGlyphs()
+}
+
+func (s *truetypeSource) face(size, dpi float64, hinting font.Hinting) font.Face {
+	return truetype.NewFace(s.ft, &truetype.Options{
+		Size:    size,
+		DPI:     dpi,
+		Hinting: hinting,
+	})
+}
+
+func (s *truetypeSource) bounds(scale fixed.Int26_6) fixed.Rectangle26_6 {
+	return s.ft.Bounds(scale)
+}
+
+func (s *truetypeSource) advance(scale fixed.Int26_6, r rune) fixed.Int26_6 {
+	return s.ft.HMetric(scale, s.ft.Index(r)).AdvanceWidth
+}
+
+func (s *truetypeSource) color(scale fixed.Int26_6, r rune) (*image.NRGBA, image.Point, bool) {
+	if s.sf == nil {
+		return nil, image.Point{}, false
+	}
+	return s.colors.draw(s.sf, &s.buf, scale, sfnt.GlyphIndex(s.ft.Index(r)))
+}
+
+func (s *truetypeSource) metrics(scale fixed.Int26_6) VerticalMetrics {
+	if s.sf != nil {
+		return sfntMetrics(s.sf, &s.buf, scale)
+	}
+	// Only the metrics are read, so a single glyph mask is cached
+	fm := truetype.NewFace(s.ft, &truetype.Options{Size: float64(scale) / 64, GlyphCacheEntries: 1}).Metrics()
+	return VerticalMetrics{
+		Ascent:  float64(fm.Ascent) / 64,
+		Descent: float64(fm.Descent) / 64,
+	}
+}
+
+func (s *truetypeSource) hasKern() bool {
+	return s.kerning
+}
+
+func (s *truetypeSource) kern(scale fixed.Int26_6, left, right int) fixed.Int26_6 {
+	return s.ft.Kern(scale, truetype.Index(left), truetype.Index(right))
+}
+
+func (s *truetypeSource) shape(scale fixed.Int26_6, hinting font.Hinting, r rune, origin sdf.Vec2) (sdf.Shape, error) {
+	var buf truetype.GlyphBuf
+	if err := buf.Load(s.ft, scale, s.ft.Index(r), hinting); err != nil {
+		return nil, err
+	}
+	return glyphShape(&buf, origin), nil
+}
@@ -0,0 +1,294 @@
+package packer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// ErrTooLarge is returned for rectangles that can never fit on a page
+var ErrTooLarge = errors.New("rectangle larger than the maximum page size")
+
+// Options controls page sizes and spacing
+type Options struct {
+	// Width and Height is the initial page size, defaults to 256x256
+	Width, Height int
+	// MaxWidth and MaxHeight is the size pages may grow to, doubling the
+	// smaller side each time up to the maximum, before a new page is started. Defaults to the
+	// initial size, meaning pages never grow
+	MaxWidth, MaxHeight int
+	// Gutter is the empty space kept between rectangles
+	Gutter int
+	// Align places rectangles at multiples of Align, with their gutter
+	// stretched so nothing else starts in the last block they touch
+	Align int
+}
+
+// Rect is a placed rectangle
+type Rect struct {
+	Page          int
+	X, Y          int
+	Width, Height int
+}
+
+type segment struct {
+	x, y, width int
+}
+
+type page struct {
+	width, height int
+	skyline       []segment
+}
+
+// Packer places rectangles on pages using the skyline bottom-left heuristic
+type Packer struct {
+	opts  Options
+	pages []*page
+}
+
+// New creates a packer with a single empty page
+func New(opts Options) *Packer {
+	if opts.Width <= 0 {
+		opts.Width = 256
+	}
+	if opts.Height <= 0 {
+		opts.Height = 256
+	}
+	if opts.MaxWidth < opts.Width {
+		opts.MaxWidth = opts.Width
+	}
+	if opts.MaxHeight < opts.Height {
+		opts.MaxHeight = opts.Height
+	}
+	if opts.Gutter < 0 {
+		opts.Gutter = 0
+	}
+	if opts.Align < 1 {
+		opts.Align = 1
+	}
+
+	p := &Packer{opts: opts}
+	p.addPage()
+	return p
+}
+
+func (p *Packer) addPage() *page {
+	pg := &page{
+		width:  p.opts.Width,
+		height: p.opts.Height,
+		skyline: []segment{
+			{x: 0, y: 0, width: p.opts.Width},
+		},
+	}
+	p.pages = append(p.pages, pg)
+	return pg
+}
+
+// Pages returns the number of pages in use
+func (p *Packer) Pages() int {
+	return len(p.pages)
+}
+
+// PageSize returns the current size of a page
+func (p *Packer) PageSize(i int) (int, int) {
+	return p.pages[i].width, p.pages[i].height
+}
+
+// Pack places a single rectangle, growing the last page or starting a new one
+// if it does not fit. Earlier pages are never revisited
+func (p *Packer) Pack(width, height int) (Rect, error) {
+	if width < 0 || height < 0 {
+		return Rect{}, fmt.Errorf("invalid rectangle %dx%d", width, height)
+	}
+	if width == 0 || height == 0 {
+		if width > p.opts.MaxWidth || height > p.opts.MaxHeight {
+			return Rect{}, ErrTooLarge
+		}
+		return Rect{Page: len(p.pages) - 1}, nil
+	}
+	aligned := func(v int) int {
+		a, g := p.opts.Align, p.opts.Gutter
+		return (v+g+a-1)/a*a - g
+	}
+	w, h := aligned(width), aligned(height)
+	if w > p.opts.MaxWidth || h > p.opts.MaxHeight {
+		return Rect{}, ErrTooLarge
+	}
+
+	for {
+		pg := p.pages[len(p.pages)-1]
+		if x, y, ok := pg.place(w, h, p.opts.Gutter); ok {
+			return Rect{
+				Page:   len(p.pages) - 1,
+				X:      x,
+				Y:      y,
+				Width:  width,
+				Height: height,
+			}, nil
+		}
+		if !pg.grow(p.opts.MaxWidth, p.opts.MaxHeight) {
+			p.addPage()
+		}
+	}
+}
+
+// PackAll places all rectangles, tallest first for a tighter fit, and returns
+// them in the order given
+func (p *Packer) PackAll(sizes []image.Point) ([]Rect, error) {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := sizes[order[a]], sizes[order[b]]
+		if sa.Y != sb.Y {
+			return sa.Y > sb.Y
+		}
+		return sa.X > sb.X
+	})
+
+	rects := make([]Rect, len(sizes))
+	for _, i := range order {
+		r, err := p.Pack(sizes[i].X, sizes[i].Y)
+		if err != nil {
+			return nil, fmt.Errorf("could not pack %dx%d: %w", sizes[i].X, sizes[i].Y, err)
+		}
+		rects[i] = r
+	}
+	return rects, nil
+}
+
+// fit returns the top of a rectangle placed at segment i, or false if it
+// would leave the page. The gutter is kept clear but may fall off the page
+func (pg *page) fit(i, width, height, gutter int) (int, bool) {
+	x := pg.skyline[i].x
+	if x+width > pg.width {
+		return 0, false
+	}
+	y := 0
+	for left := width + gutter; left > 0 && i < len(pg.skyline); i++ {
+		if pg.skyline[i].y > y {
+			y = pg.skyline[i].y
+		}
+		left -= pg.skyline[i].width
+	}
+	if y+height > pg.height {
+		return 0, false
+	}
+	return y, true
+}
+
+func (pg *page) place(width, height, gutter int) (int, int, bool) {
+	best := -1
+	bestY, bestWidth := 0, 0
+	for i := range pg.skyline {
+		y, ok := pg.fit(i, width, height, gutter)
+		if !ok {
+			continue
+		}
+		if best < 0 || y < bestY || (y == bestY && pg.skyline[i].width < bestWidth) {
+			best = i
+			bestY = y
+			bestWidth = pg.skyline[i].width
+		}
+	}
+	if best < 0 {
+		return 0, 0, false
+	}
+
+	x := pg.skyline[best].x
+	pg.raise(best, x, bestY+height+gutter, width+gutter)
+	return x, bestY, true
+}
+
+// raise puts a new segment at segment i, cutting away what it covers. The
+// skyline may reach past the page by a gutter
+func (pg *page) raise(i, x, y, width int) {
+	pg.skyline = append(pg.skyline, segment{})
+	copy(pg.skyline[i+1:], pg.skyline[i:])
+	pg.skyline[i] = segment{x: x, y: y, width: width}
+
+	for j := i + 1; j < len(pg.skyline); {
+		prev := pg.skyline[j-1]
+		curr := &pg.skyline[j]
+		if curr.x >= prev.x+prev.width {
+			break
+		}
+		shrink := prev.x + prev.width - curr.x
+		curr.x += shrink
+		curr.width -= shrink
+		if curr.width > 0 {
+			break
+		}
+		pg.skyline = append(pg.skyline[:j], pg.skyline[j+1:]...)
+	}
+
+	for j := 0; j+1 < len(pg.skyline); {
+		if pg.skyline[j].y == pg.skyline[j+1].y {
+			pg.skyline[j].width += pg.skyline[j+1].width
+			pg.skyline = append(pg.skyline[:j+1], pg.skyline[j+2:]...)
+		} else {
+			j++
+		}
+	}
+}
+
+// grow doubles the smaller side of the page, the last step stopping at the
+// limits so pages always reach the maximum size
+func (pg *page) grow(maxWidth, maxHeight int) bool {
+	canWidth := pg.width < maxWidth
+	canHeight := pg.height < maxHeight
+	if !canWidth && !canHeight {
+		return false
+	}
+
+	if canWidth && (pg.width <= pg.height || !canHeight) {
+		width := pg.width * 2
+		if width > maxWidth {
+			width = maxWidth
+		}
+		last := &pg.skyline[len(pg.skyline)-1]
+		end := last.x + last.width
+		if last.y == 0 {
+			last.width = width - last.x
+		} else if end < width {
+			pg.skyline = append(pg.skyline, segment{x: end, y: 0, width: width - end})
+		}
+		pg.width = width
+	} else {
+		pg.height *= 2
+		if pg.height > maxHeight {
+			pg.height = maxHeight
+		}
+	}
+	return true
+}
+
+// PackImages packs the images onto as many pages as needed, returning the
+// pages and where each image was placed
+func PackImages(imgs []image.Image, opts Options) ([]*image.RGBA, []Rect, error) {
+	sizes := make([]image.Point, len(imgs))
+	for i, img := range imgs {
+		sizes[i] = img.Bounds().Size()
+	}
+
+	p := New(opts)
+	rects, err := p.PackAll(sizes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pages := make([]*image.RGBA, p.Pages())
+	for i := range pages {
+		w, h := p.PageSize(i)
+		pages[i] = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	for i, img := range imgs {
+		r := rects[i]
+		dst := image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+		draw.Draw(pages[r.Page], dst, img, img.Bounds().Min, draw.Src)
+	}
+	return pages, rects, nil
+}
@@ -0,0 +1,220 @@
+package packer
+
+import (
+	"errors"
+	"image"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// checkRects fails if any rect leaves its page or comes within the gutter of
+// another on the same page
+func checkRects(t *testing.T, p *Packer, rects []Rect, gutter int) {
+	t.Helper()
+	for i, a := range rects {
+		if a.Page < 0 || a.Page >= p.Pages() {
+			t.Fatalf("rect %d on page %d of %d", i, a.Page, p.Pages())
+		}
+		w, h := p.PageSize(a.Page)
+		if a.X < 0 || a.Y < 0 || a.X+a.Width > w || a.Y+a.Height > h {
+			t.Fatalf("rect %d %+v outside page %dx%d", i, a, w, h)
+		}
+		if a.Width == 0 || a.Height == 0 {
+			continue
+		}
+		ra := image.Rect(a.X, a.Y, a.X+a.Width+gutter, a.Y+a.Height+gutter)
+		for j := i + 1; j < len(rects); j++ {
+			b := rects[j]
+			if b.Page != a.Page || b.Width == 0 || b.Height == 0 {
+				continue
+			}
+			rb := image.Rect(b.X, b.Y, b.X+b.Width+gutter, b.Y+b.Height+gutter)
+			if ra.Overlaps(rb) {
+				t.Fatalf("rects %d %+v and %d %+v overlap with gutter %d", i, a, j, b, gutter)
+			}
+		}
+	}
+}
+
+func randomSizes(seed int64, n, max int) []image.Point {
+	rnd := rand.New(rand.NewSource(seed))
+	sizes := make([]image.Point, n)
+	for i := range sizes {
+		sizes[i] = image.Pt(1+rnd.Intn(max), 1+rnd.Intn(max))
+	}
+	return sizes
+}
+
+func TestPackAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		sizes []image.Point
+	}{
+		{"single page", Options{Width: 256, Height: 256}, randomSizes(1, 40, 24)},
+		{"gutter", Options{Width: 256, Height: 256, Gutter: 2}, randomSizes(2, 40, 24)},
+		{"growing", Options{Width: 64, Height: 64, MaxWidth: 512, MaxHeight: 512, Gutter: 1}, randomSizes(3, 200, 30)},
+		{"many pages", Options{Width: 64, Height: 64, Gutter: 1}, randomSizes(4, 200, 30)},
+		{"aligned", Options{Width: 128, Height: 128, Gutter: 4, Align: 4}, randomSizes(5, 100, 20)},
+		{"empty", Options{Width: 16, Height: 16}, []image.Point{{0, 5}, {5, 0}, {16, 16}, {0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.opts)
+			rects, err := p.PackAll(tt.sizes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, r := range rects {
+				// Empty rects take no space and have no size
+				if tt.sizes[i].X == 0 || tt.sizes[i].Y == 0 {
+					if r.Width != 0 || r.Height != 0 {
+						t.Fatalf("empty rect %d placed as %+v", i, r)
+					}
+					continue
+				}
+				if r.Width != tt.sizes[i].X || r.Height != tt.sizes[i].Y {
+					t.Fatalf("rect %d is %dx%d, want %v", i, r.Width, r.Height, tt.sizes[i])
+				}
+				if a := p.opts.Align; r.X%a != 0 || r.Y%a != 0 {
+					t.Fatalf("rect %d %+v not aligned to %d", i, r, a)
+				}
+			}
+			checkRects(t, p, rects, p.opts.Gutter)
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	p := New(Options{Width: 32, Height: 32})
+	var rects []Rect
+	for i := 0; i < 5; i++ {
+		r, err := p.Pack(16, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rects = append(rects, r)
+	}
+	if p.Pages() != 2 {
+		t.Fatalf("got %d pages, want 2", p.Pages())
+	}
+	for i, r := range rects {
+		if want := i / 4; r.Page != want {
+			t.Fatalf("rect %d on page %d, want %d", i, r.Page, want)
+		}
+	}
+	if w, h := p.PageSize(0); w != 32 || h != 32 {
+		t.Fatalf("page grew to %dx%d without a max size", w, h)
+	}
+	checkRects(t, p, rects, 0)
+}
+
+func TestGrow(t *testing.T) {
+	p := New(Options{Width: 16, Height: 16, MaxWidth: 32, MaxHeight: 32})
+	for i := 0; i < 4; i++ {
+		if _, err := p.Pack(16, 16); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Pages() != 1 {
+		t.Fatalf("got %d pages, want the first to grow", p.Pages())
+	}
+	if w, h := p.PageSize(0); w != 32 || h != 32 {
+		t.Fatalf("page is %dx%d, want 32x32", w, h)
+	}
+	r, err := p.Pack(16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Page != 1 {
+		t.Fatalf("rect on page %d once the first is full, want 1", r.Page)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		width, height int
+	}{
+		{"wide", Options{Width: 16, Height: 16}, 17, 1},
+		{"tall", Options{Width: 16, Height: 16, MaxWidth: 64}, 1, 17},
+		{"aligned", Options{Width: 16, Height: 16, Align: 8, Gutter: 1}, 16, 1},
+		{"empty", Options{Width: 16, Height: 16}, 0, 17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts).Pack(tt.width, tt.height); !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("got %v, want ErrTooLarge", err)
+			}
+		})
+	}
+	if _, err := New(Options{}).Pack(-1, 1); err == nil || errors.Is(err, ErrTooLarge) {
+		t.Fatalf("got %v for a negative size", err)
+	}
+}
+
+// Pages grow to the maximum size even when doubling steps past it
+func TestGrowToMax(t *testing.T) {
+	done := make(chan error, 1)
+	var p *Packer
+	var r Rect
+	go func() {
+		var err error
+		p = New(Options{Width: 256, Height: 256, MaxWidth: 300, MaxHeight: 256})
+		r, err = p.Pack(280, 10)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("packing a rect below the maximum size did not finish")
+	}
+	if p.Pages() != 1 || r.Page != 0 {
+		t.Fatalf("rect on page %d of %d, want the first", r.Page, p.Pages())
+	}
+	if w, h := p.PageSize(0); w != 300 || h != 256 {
+		t.Fatalf("page is %dx%d, want 300x256", w, h)
+	}
+	checkRects(t, p, []Rect{r}, 0)
+
+	p = New(Options{Width: 16, Height: 16, MaxWidth: 40, MaxHeight: 24})
+	for i := 0; i < 3; i++ {
+		if _, err := p.Pack(20, 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Pages() != 2 {
+		t.Fatalf("got %d pages, want 2", p.Pages())
+	}
+	if w, h := p.PageSize(0); w != 40 || h != 24 {
+		t.Fatalf("page is %dx%d, want 40x24", w, h)
+	}
+}
+
+func TestPackImages(t *testing.T) {
+	imgs := make([]image.Image, 20)
+	for i := range imgs {
+		img := image.NewRGBA(image.Rect(0, 0, 10+i, 10))
+		for j := range img.Pix {
+			img.Pix[j] = uint8(i + 1)
+		}
+		imgs[i] = img
+	}
+	pages, rects, err := PackImages(imgs, Options{Width: 64, Height: 64, Gutter: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) < 2 {
+		t.Fatalf("got %d pages, want the images to spill over", len(pages))
+	}
+	for i, r := range rects {
+		if got := pages[r.Page].RGBAAt(r.X, r.Y).R; got != uint8(i+1) {
+			t.Fatalf("image %d at %+v reads %d", i, r, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package sdf
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Info describes the contents of an encoded distance field
+type Info struct {
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Encoding  string  `json:"encoding"`
+	Min       int     `json:"min"`
+	Max       int     `json:"max"`
+	Spread    float64 `json:"spread"`
+	Inside    int     `json:"inside"`
+	Outside   int     `json:"outside"`
+	Histogram []int   `json:"histogram"`
+}
+
+// Encoding returns a short name for the color model of the image
+func Encoding(img image.Image) string {
+	switch img.(type) {
+	case *image.Gray:
+		return "gray8"
+	case *image.Gray16:
+		return "gray16"
+	case *image.Alpha:
+		return "alpha8"
+	case *image.Alpha16:
+		return "alpha16"
+	case *image.RGBA:
+		return "rgba8"
+	case *image.RGBA64:
+		return "rgba16"
+	case *image.NRGBA:
+		return "nrgba8"
+	case *image.NRGBA64:
+		return "nrgba16"
+	case *image.Paletted:
+		return "paletted"
+	case *image.YCbCr:
+		return "ycbcr"
+	}
+	return "unknown"
+}
+
+// value reads the 8 bit distance value for a pixel, using the red channel the
+// same way Generate reads its source
+func value(img image.Image, x, y int) int {
+	switch c := img.At(x, y).(type) {
+	case color.Gray:
+		return int(c.Y)
+	case color.Alpha:
+		return int(c.A)
+	default:
+		r, _, _, _ := c.RGBA()
+		return int(r >> 8)
+	}
+}
+
+// Inspect scans an encoded distance field, as produced by Generate, and
+// reports its value range, inside/outside split and a histogram with the
+// given number of bins.
+// The spread is inferred from the median gradient of the unsaturated pixels
+// and is the distance in pixels from the edge to a fully saturated value.
+func Inspect(img image.Image, bins int) Info {
+	if bins < 1 || bins > 256 {
+		bins = 256
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	info := Info{
+		Width:     width,
+		Height:    height,
+		Encoding:  Encoding(img),
+		Min:       255,
+		Max:       0,
+		Histogram: make([]int, bins),
+	}
+
+	vals := make([]int, width*height)
+	for y := 0; y < height; y++ {
+		i := y * width
+		for x := 0; x < width; x++ {
+			v := value(img, bounds.Min.X+x, bounds.Min.Y+y)
+			vals[i+x] = v
+
+			if v < info.Min {
+				info.Min = v
+			}
+			if v > info.Max {
+				info.Max = v
+			}
+			if v >= 128 {
+				info.Inside++
+			} else {
+				info.Outside++
+			}
+			info.Histogram[v*bins/256]++
+		}
+	}
+
+	var grads []float64
+	for y := 1; y < height-1; y++ {
+		i := y * width
+		for x := 1; x < width-1; x++ {
+			if v := vals[i+x]; v <= info.Min || v >= info.Max {
+				continue
+			}
+			dx := float64(vals[i+x+1]-vals[i+x-1]) / 2
+			dy := float64(vals[i+x+width]-vals[i+x-width]) / 2
+			if g := math.Sqrt(dx*dx + dy*dy); g > 0 {
+				grads = append(grads, g)
+			}
+		}
+	}
+	if len(grads) > 0 {
+		sort.Float64s(grads)
+		info.Spread = 128 / grads[len(grads)/2]
+	}
+
+	return info
+}
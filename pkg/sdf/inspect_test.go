@@ -0,0 +1,76 @@
+package sdf
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// A ramp of 4 values a pixel saturates 32 pixels from the edge
+func TestInspect(t *testing.T) {
+	img := image.NewGray(image.Rect(10, 10, 106, 18))
+	for y := 10; y < 18; y++ {
+		for x := 0; x < 96; x++ {
+			v := 128 + 4*(x-48)
+			if v < 0 {
+				v = 0
+			}
+			if v > 255 {
+				v = 255
+			}
+			img.SetGray(10+x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+
+	info := Inspect(img, 16)
+	if info.Width != 96 || info.Height != 8 || info.Encoding != "gray8" {
+		t.Fatalf("got %dx%d %s, want 96x8 gray8", info.Width, info.Height, info.Encoding)
+	}
+	if info.Min != 0 || info.Max != 255 {
+		t.Fatalf("range %d-%d, want 0-255", info.Min, info.Max)
+	}
+	if info.Inside != 48*8 || info.Outside != 48*8 {
+		t.Fatalf("%d inside and %d outside, want %d each", info.Inside, info.Outside, 48*8)
+	}
+	var sum int
+	for _, n := range info.Histogram {
+		sum += n
+	}
+	if len(info.Histogram) != 16 || sum != 96*8 {
+		t.Fatalf("histogram %v, want 16 bins of %d pixels", info.Histogram, 96*8)
+	}
+	// Saturated columns fill the outermost bins
+	if info.Histogram[0] < 16*8 || info.Histogram[15] < 16*8 {
+		t.Fatalf("histogram %v, want the saturated columns at the ends", info.Histogram)
+	}
+	if info.Spread != 32 {
+		t.Fatalf("spread %f, want 32", info.Spread)
+	}
+
+	if got := Inspect(img, 0); len(got.Histogram) != 256 {
+		t.Fatalf("%d bins, want 256 for an invalid count", len(got.Histogram))
+	}
+}
+
+func TestInspectGenerated(t *testing.T) {
+	const spread = 16.0
+	src := testCircle(128, 40)
+	field, err := GenerateWithOptions(src, Options{Spread: spread, Algorithm: AlgorithmBrute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := Inspect(field, 256)
+	if math.Abs(info.Spread-spread) > spread/10 {
+		t.Fatalf("spread %f, want about %f", info.Spread, spread)
+	}
+	var inside int
+	for _, v := range field.(*image.Gray).Pix {
+		if v >= 128 {
+			inside++
+		}
+	}
+	if info.Inside != inside || info.Inside+info.Outside != 128*128 {
+		t.Fatalf("%d inside and %d outside, want %d inside", info.Inside, info.Outside, inside)
+	}
+}
@@ -0,0 +1,335 @@
+package sdf
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Vec2 is a point or direction in pixel space, y grows downwards
+type Vec2 struct {
+	X, Y float64
+}
+
+func (v Vec2) sub(o Vec2) Vec2 {
+	return Vec2{X: v.X - o.X, Y: v.Y - o.Y}
+}
+
+func (v Vec2) dot(o Vec2) float64 {
+	return v.X*o.X + v.Y*o.Y
+}
+
+func (v Vec2) cross(o Vec2) float64 {
+	return v.X*o.Y - v.Y*o.X
+}
+
+func (v Vec2) length() float64 {
+	return math.Sqrt(v.dot(v))
+}
+
+func (v Vec2) normalize() Vec2 {
+	l := v.length()
+	if l == 0 {
+		return Vec2{}
+	}
+	return Vec2{X: v.X / l, Y: v.Y / l}
+}
+
+// Edge is a smooth piece of an outline, curves are flattened into several
+// points
+type Edge struct {
+	Points []Vec2
+}
+
+// Contour is a closed loop of edges, each edge starting where the previous
+// one ended
+type Contour []Edge
+
+// Shape is an outline made up of one or more contours
+type Shape []Contour
+
+const (
+	channelRed = 1 << iota
+	channelGreen
+	channelBlue
+
+	colorWhite   = channelRed | channelGreen | channelBlue
+	colorCyan    = channelGreen | channelBlue
+	colorMagenta = channelRed | channelBlue
+	colorYellow  = channelRed | channelGreen
+)
+
+// sin(3), corners sharper than this are kept sharp
+const cornerThreshold = 0.1411
+
+type coloredEdge struct {
+	points []Vec2
+	color  int
+}
+
+// colorEdges assigns channels to the edges so that edges meeting at a corner
+// never share all channels, which is what keeps the corners sharp
+func colorEdges(shape Shape) []coloredEdge {
+	var edges []coloredEdge
+	for _, contour := range shape {
+		var corners []int
+		isCorner := make([]bool, len(contour))
+		for i, e := range contour {
+			prev := contour[(i+len(contour)-1)%len(contour)]
+			if len(e.Points) < 2 || len(prev.Points) < 2 {
+				continue
+			}
+			in := prev.Points[len(prev.Points)-1].sub(prev.Points[len(prev.Points)-2]).normalize()
+			out := e.Points[1].sub(e.Points[0]).normalize()
+			if in.dot(out) <= 0 || math.Abs(in.cross(out)) > cornerThreshold {
+				corners = append(corners, i)
+				isCorner[i] = true
+			}
+		}
+
+		colors := make([]int, len(contour))
+		switch {
+		case len(corners) == 0:
+			for i := range colors {
+				colors[i] = colorWhite
+			}
+		case len(corners) == 1:
+			// Teardrop, split the loop into three differently colored parts
+			thirds := []int{colorCyan, colorMagenta, colorYellow}
+			for i := range colors {
+				if len(contour) < 3 {
+					colors[i] = colorWhite
+					continue
+				}
+				j := (i - corners[0] + len(contour)) % len(contour)
+				colors[i] = thirds[j*3/len(contour)]
+			}
+		default:
+			cycle := []int{colorCyan, colorMagenta, colorYellow}
+			spline := 0
+			for n := 0; n < len(contour); n++ {
+				i := (corners[0] + n) % len(contour)
+				if n > 0 && isCorner[i] {
+					spline++
+				}
+				c := cycle[spline%3]
+				if spline == len(corners)-1 && len(corners)%3 == 1 {
+					// The last spline would otherwise match the first one
+					c = cycle[1]
+				}
+				colors[i] = c
+			}
+		}
+
+		for i, e := range contour {
+			edges = append(edges, coloredEdge{points: e.Points, color: colors[i]})
+		}
+	}
+	return edges
+}
+
+// area is the signed area of the shape, its sign tells the winding of the
+// outer contours
+func (s Shape) area() float64 {
+	var area float64
+	for _, contour := range s {
+		for _, e := range contour {
+			for i := 0; i+1 < len(e.Points); i++ {
+				area += e.Points[i].cross(e.Points[i+1])
+			}
+		}
+	}
+	return area / 2
+}
+
+// winding is the nonzero winding number of the shape around p
+func (s Shape) winding(p Vec2) int {
+	var winding int
+	for _, contour := range s {
+		for _, e := range contour {
+			for i := 0; i+1 < len(e.Points); i++ {
+				a, b := e.Points[i], e.Points[i+1]
+				if a.Y <= p.Y {
+					if b.Y > p.Y && b.sub(a).cross(p.sub(a)) > 0 {
+						winding++
+					}
+				} else if b.Y <= p.Y && b.sub(a).cross(p.sub(a)) < 0 {
+					winding--
+				}
+			}
+		}
+	}
+	return winding
+}
+
+type edgeDistance struct {
+	dist, orthogonality, pseudo float64
+}
+
+// distance finds the closest point on the edge, pseudo is the signed distance
+// with the ends of the edge extended along their tangents
+func (e *coloredEdge) distance(p Vec2, winding float64) edgeDistance {
+	best := edgeDistance{dist: math.MaxFloat64}
+	var bestPiece int
+	var bestT float64
+	for i := 0; i+1 < len(e.points); i++ {
+		a, b := e.points[i], e.points[i+1]
+		ab := b.sub(a)
+		lenSq := ab.dot(ab)
+		if lenSq == 0 {
+			continue
+		}
+		t := p.sub(a).dot(ab) / lenSq
+		ct := math.Max(0, math.Min(1, t))
+		closest := Vec2{X: a.X + ab.X*ct, Y: a.Y + ab.Y*ct}
+		if d := p.sub(closest).length(); d < best.dist {
+			best.dist = d
+			best.orthogonality = math.Abs(ab.normalize().cross(p.sub(closest).normalize()))
+			bestPiece = i
+			bestT = t
+		}
+	}
+	if best.dist == math.MaxFloat64 {
+		return best
+	}
+
+	a, b := e.points[bestPiece], e.points[bestPiece+1]
+	dir := b.sub(a).normalize()
+	side := dir.cross(p.sub(a)) * winding
+	best.pseudo = best.dist
+	if side < 0 {
+		best.pseudo = -best.dist
+	}
+	if (bestPiece == 0 && bestT < 0) || (bestPiece == len(e.points)-2 && bestT > 1) {
+		if perp := dir.cross(p.sub(a)) * winding; math.Abs(perp) <= best.dist {
+			best.pseudo = perp
+		}
+	}
+	return best
+}
+
+func median(c [3]float64) float64 {
+	return math.Max(math.Min(c[0], c[1]), math.Min(math.Max(c[0], c[1]), c[2]))
+}
+
+// clash reports whether a and b disagree in two channels by more than a pixel,
+// flagging only the texel farther from the edge
+func clash(a, b [3]float64) bool {
+	order := []int{0, 1, 2}
+	diff := func(i int) float64 {
+		return math.Abs(a[order[i]] - b[order[i]])
+	}
+	if diff(0) < diff(1) {
+		order[0], order[1] = order[1], order[0]
+	}
+	if diff(1) < diff(2) {
+		order[1], order[2] = order[2], order[1]
+		if diff(0) < diff(1) {
+			order[0], order[1] = order[1], order[0]
+		}
+	}
+	return diff(1) >= 1.001 &&
+		!(b[0] == b[1] && b[0] == b[2]) &&
+		math.Abs(a[order[2]]) >= math.Abs(b[order[2]])
+}
+
+// GenerateMSDF calculates a multi-channel signed distance field for the shape,
+// the median of the red, green and blue channels is the distance.
+// Values are encoded like Generate, 128 being the edge and spread the distance
+// in pixels to a saturated value.
+func GenerateMSDF(shape Shape, width, height int, spread float64) *image.RGBA {
+	if spread <= 0 {
+		spread = DefaultSpread
+	}
+
+	dest := image.NewRGBA(image.Rect(0, 0, width, height))
+	edges := colorEdges(shape)
+	if len(edges) == 0 {
+		return dest
+	}
+
+	winding := 1.0
+	if shape.area() < 0 {
+		winding = -1.0
+	}
+
+	dists := make([]edgeDistance, len(edges))
+	field := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := Vec2{X: float64(x) + 0.5, Y: float64(y) + 0.5}
+			for i := range edges {
+				dists[i] = edges[i].distance(p, winding)
+			}
+
+			var channels [3]float64
+			for c := 0; c < 3; c++ {
+				best := -1
+				for i, e := range edges {
+					if e.color&(1<<uint(c)) == 0 {
+						continue
+					}
+					if best < 0 || dists[i].dist < dists[best].dist ||
+						(dists[i].dist == dists[best].dist && dists[i].orthogonality > dists[best].orthogonality) {
+						best = i
+					}
+				}
+				if best >= 0 {
+					channels[c] = dists[best].pseudo
+				} else {
+					channels[c] = -spread
+				}
+			}
+
+			// Channels picking up edges from elsewhere in the shape can flip the
+			// median, fall back to the plain distance for those pixels
+			closest := math.MaxFloat64
+			for _, d := range dists {
+				closest = math.Min(closest, d.dist)
+			}
+			if shape.winding(p) == 0 {
+				closest = -closest
+			}
+			if (median(channels) < 0) != (closest < 0) {
+				channels = [3]float64{closest, closest, closest}
+			}
+			field[(y*width)+x] = channels
+		}
+	}
+
+	// Neighbours whose channels cross over each other interpolate into false
+	// edges, flatten the one farther from the edge
+	var clashes []int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := (y * width) + x
+			if (x > 0 && clash(field[i], field[i-1])) ||
+				(x < width-1 && clash(field[i], field[i+1])) ||
+				(y > 0 && clash(field[i], field[i-width])) ||
+				(y < height-1 && clash(field[i], field[i+width])) {
+				clashes = append(clashes, i)
+			}
+		}
+	}
+	for _, i := range clashes {
+		m := median(field[i])
+		field[i] = [3]float64{m, m, m}
+	}
+
+	encode := func(d float64) uint8 {
+		return uint8(math.Max(0, math.Min(255, math.Round(d*128/spread)+128)))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			channels := field[(y*width)+x]
+			dest.SetRGBA(x, y, color.RGBA{
+				R: encode(channels[0]),
+				G: encode(channels[1]),
+				B: encode(channels[2]),
+				A: 255,
+			})
+		}
+	}
+
+	return dest
+}
@@ -0,0 +1,72 @@
+package sdf
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// testSquare is a square outline with its edges in the given order
+func testSquare(min, max float64, reverse bool) Shape {
+	corners := []Vec2{{min, min}, {max, min}, {max, max}, {min, max}}
+	if reverse {
+		corners[1], corners[3] = corners[3], corners[1]
+	}
+	var contour Contour
+	for i, c := range corners {
+		contour = append(contour, Edge{Points: []Vec2{c, corners[(i+1)%len(corners)]}})
+	}
+	return Shape{contour}
+}
+
+// squareDistance is the signed distance from p to the square, positive inside
+func squareDistance(p Vec2, min, max float64) float64 {
+	dx := math.Max(min-p.X, p.X-max)
+	dy := math.Max(min-p.Y, p.Y-max)
+	if dx < 0 && dy < 0 {
+		return -math.Max(dx, dy)
+	}
+	return -math.Hypot(math.Max(dx, 0), math.Max(dy, 0))
+}
+
+func TestGenerateMSDF(t *testing.T) {
+	const (
+		size   = 32
+		min    = 8.0
+		max    = 24.0
+		spread = 8.0
+	)
+	for _, reverse := range []bool{false, true} {
+		img := GenerateMSDF(testSquare(min, max, reverse), size, size, spread)
+		if img.Rect != image.Rect(0, 0, size, size) {
+			t.Fatalf("field is %v, want %dx%d", img.Rect, size, size)
+		}
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				c := img.RGBAAt(x, y)
+				m := median([3]float64{float64(c.R), float64(c.G), float64(c.B)})
+				p := Vec2{X: float64(x) + 0.5, Y: float64(y) + 0.5}
+				want := squareDistance(p, min, max)
+				if (m >= 128) != (want > 0) {
+					t.Fatalf("reverse %v: median at %d,%d is %f, distance is %f", reverse, x, y, m, want)
+				}
+				// Outside the corners the median is the distance to the
+				// extended edges, which is what keeps them sharp
+				if (p.X < min || p.X > max) && (p.Y < min || p.Y > max) {
+					continue
+				}
+				want = math.Max(-spread, math.Min(spread, want))
+				if got := (m - 128) * spread / 128; math.Abs(got-want) > 0.1 {
+					t.Fatalf("reverse %v: distance at %d,%d is %f, want %f", reverse, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	empty := GenerateMSDF(nil, 4, 4, spread)
+	for i, v := range empty.Pix {
+		if v != 0 {
+			t.Fatalf("empty shape byte %d is %d", i, v)
+		}
+	}
+}
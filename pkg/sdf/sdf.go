@@ -1,6 +1,7 @@
 package sdf
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"math"
@@ -32,7 +33,8 @@ func (g *Grid) compare(p Point, x, y, offsetx, offsety int) Point {
 		}
 		return p
 	}
-	return Point{dx: 9999, dy: 9999}
+	// Past the edge there is nothing closer, keep what was found so far
+	return p
 }
 
 // Generate generates the SDF for the grid
@@ -72,52 +74,145 @@ func (g *Grid) Generate() {
 	}
 }
 
+// Channel selects which part of the source color is thresholded
+type Channel string
+
+// Available channels
+const (
+	ChannelRed   Channel = "r"
+	ChannelGreen Channel = "g"
+	ChannelBlue  Channel = "b"
+	ChannelAlpha Channel = "a"
+	ChannelLuma  Channel = "luma"
+)
+
+// Algorithm selects how distances are calculated
+type Algorithm string
+
+// Available algorithms
+const (
+	// Algorithm8SSEDT is the fast two pass sweep, distances are truncated to
+	// whole pixels
+	Algorithm8SSEDT Algorithm = "8ssedt"
+	// AlgorithmBrute searches every pixel within the spread for the exact
+	// distance, slow but precise
+	AlgorithmBrute Algorithm = "brute"
+)
+
+// DefaultSpread maps a distance of ~42 pixels to the full value range
+const DefaultSpread = 128.0 / 3.0
+
+// Options controls the generated field, the zero value matches Generate
+type Options struct {
+	// Spread is the distance in output pixels from the edge to a saturated
+	// value, defaults to DefaultSpread
+	Spread float64 `json:"spread,omitempty"`
+	// Threshold is the channel value (0-255) above which a pixel is inside
+	Threshold uint8 `json:"threshold,omitempty"`
+	// Channel defaults to ChannelRed
+	Channel Channel `json:"channel,omitempty"`
+	// Scale downsamples the output by the given factor, defaults to 1
+	Scale int `json:"scale,omitempty"`
+	// Algorithm defaults to Algorithm8SSEDT
+	Algorithm Algorithm `json:"algorithm,omitempty"`
+}
+
+// Normalize fills in the defaults, options that only differ in leaving out a
+// default normalize to the same
+func (o *Options) Normalize() error {
+	if o.Spread < 0 {
+		return fmt.Errorf("invalid spread %f", o.Spread)
+	}
+	if o.Spread == 0 {
+		o.Spread = DefaultSpread
+	}
+	if o.Scale < 0 {
+		return fmt.Errorf("invalid scale %d", o.Scale)
+	}
+	if o.Scale == 0 {
+		o.Scale = 1
+	}
+	switch o.Channel {
+	case "":
+		o.Channel = ChannelRed
+	case ChannelRed, ChannelGreen, ChannelBlue, ChannelAlpha, ChannelLuma:
+	default:
+		return fmt.Errorf("unknown channel \"%s\"", o.Channel)
+	}
+	switch o.Algorithm {
+	case "":
+		o.Algorithm = Algorithm8SSEDT
+	case Algorithm8SSEDT, AlgorithmBrute:
+	default:
+		return fmt.Errorf("unknown algorithm \"%s\"", o.Algorithm)
+	}
+	return nil
+}
+
+func (o *Options) inside(c color.Color) bool {
+	var v uint32
+	switch o.Channel {
+	case ChannelRed:
+		v, _, _, _ = c.RGBA()
+	case ChannelGreen:
+		_, v, _, _ = c.RGBA()
+	case ChannelBlue:
+		_, _, v, _ = c.RGBA()
+	case ChannelAlpha:
+		_, _, _, v = c.RGBA()
+	case ChannelLuma:
+		v = uint32(color.Gray16Model.Convert(c).(color.Gray16).Y)
+	}
+	return v >= uint32(o.Threshold)*257+128
+}
+
 // Generate calculates a signed distance field and encodes it into an image.
 // Algorithm adapted from http://www.codersnotes.com/notes/signed-distance-fields/
 func Generate(src image.Image) (image.Image, error) {
-	srcWidth := src.Bounds().Dx()
-	srcHeight := src.Bounds().Dy()
-	grid1 := Grid{
-		width:  srcWidth,
-		height: srcHeight,
-		pts:    make([]Point, srcWidth*srcHeight),
-	}
-	grid2 := Grid{
-		width:  srcWidth,
-		height: srcHeight,
-		pts:    make([]Point, srcWidth*srcHeight),
+	return GenerateWithOptions(src, Options{})
+}
+
+// GenerateWithOptions calculates a signed distance field using opts and
+// encodes it into an image, 128 being the edge
+func GenerateWithOptions(src image.Image, opts Options) (image.Image, error) {
+	if err := opts.Normalize(); err != nil {
+		return nil, err
 	}
 
+	srcWidth := src.Bounds().Dx()
+	srcHeight := src.Bounds().Dy()
+	mask := make([]bool, srcWidth*srcHeight)
 	for y := 0; y < srcHeight; y++ {
 		i := y * srcWidth
 		for x := 0; x < srcWidth; x++ {
-			c := src.At(x, y)
-			if r, _, _, _ := c.RGBA(); r < 128 {
-				grid1.pts[i+x].dx = 0
-				grid1.pts[i+x].dy = 0
-				grid2.pts[i+x].dx = 9999
-				grid2.pts[i+x].dy = 9999
-			} else {
-				grid1.pts[i+x].dx = 9999
-				grid1.pts[i+x].dy = 9999
-				grid2.pts[i+x].dx = 0
-				grid2.pts[i+x].dy = 0
-			}
+			mask[i+x] = opts.inside(src.At(src.Bounds().Min.X+x, src.Bounds().Min.Y+y))
 		}
 	}
 
-	grid1.Generate()
-	grid2.Generate()
+	var dists []float64
+	switch opts.Algorithm {
+	case Algorithm8SSEDT:
+		dists = sweep(mask, srcWidth, srcHeight)
+	case AlgorithmBrute:
+		dists = brute(mask, srcWidth, srcHeight, int(math.Ceil(opts.Spread*float64(opts.Scale)))+1)
+	}
 
-	dest := image.NewGray(image.Rect(0, 0, srcWidth, srcHeight))
-	for y := 0; y < srcHeight; y++ {
-		i := y * srcWidth
-		for x := 0; x < srcWidth; x++ {
-			dist1 := int(math.Sqrt(float64(grid1.pts[i+x].DistSq())))
-			dist2 := int(math.Sqrt(float64(grid2.pts[i+x].DistSq())))
-			dist := dist1 - dist2
+	destWidth := (srcWidth + opts.Scale - 1) / opts.Scale
+	destHeight := (srcHeight + opts.Scale - 1) / opts.Scale
+	factor := 128 / opts.Spread / float64(opts.Scale)
+	dest := image.NewGray(image.Rect(0, 0, destWidth, destHeight))
+	for y := 0; y < destHeight; y++ {
+		sy := y*opts.Scale + opts.Scale/2
+		if sy >= srcHeight {
+			sy = srcHeight - 1
+		}
+		for x := 0; x < destWidth; x++ {
+			sx := x*opts.Scale + opts.Scale/2
+			if sx >= srcWidth {
+				sx = srcWidth - 1
+			}
 
-			c := (dist*3 + 128)
+			c := int(math.Round(dists[(sy*srcWidth)+sx]*factor)) + 128
 			if c < 0 {
 				c = 0
 			}
@@ -130,3 +225,76 @@ func Generate(src image.Image) (image.Image, error) {
 
 	return dest, nil
 }
+
+// sweep calculates signed distances, positive inside, using 8SSEDT
+func sweep(mask []bool, width, height int) []float64 {
+	grid1 := Grid{
+		width:  width,
+		height: height,
+		pts:    make([]Point, width*height),
+	}
+	grid2 := Grid{
+		width:  width,
+		height: height,
+		pts:    make([]Point, width*height),
+	}
+
+	for i, in := range mask {
+		if !in {
+			grid1.pts[i].dx = 0
+			grid1.pts[i].dy = 0
+			grid2.pts[i].dx = 9999
+			grid2.pts[i].dy = 9999
+		} else {
+			grid1.pts[i].dx = 9999
+			grid1.pts[i].dy = 9999
+			grid2.pts[i].dx = 0
+			grid2.pts[i].dy = 0
+		}
+	}
+
+	grid1.Generate()
+	grid2.Generate()
+
+	dists := make([]float64, width*height)
+	for i := range dists {
+		dist1 := int(math.Sqrt(float64(grid1.pts[i].DistSq())))
+		dist2 := int(math.Sqrt(float64(grid2.pts[i].DistSq())))
+		dists[i] = float64(dist1 - dist2)
+	}
+	return dists
+}
+
+// brute calculates exact signed distances, positive inside, searching at most
+// radius pixels away
+func brute(mask []bool, width, height, radius int) []float64 {
+	dists := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			in := mask[(y*width)+x]
+			best := radius * radius
+			for oy := -radius; oy <= radius; oy++ {
+				py := y + oy
+				if py < 0 || py >= height || oy*oy >= best {
+					continue
+				}
+				for ox := -radius; ox <= radius; ox++ {
+					px := x + ox
+					if px < 0 || px >= width {
+						continue
+					}
+					if d := ox*ox + oy*oy; d < best && mask[(py*width)+px] != in {
+						best = d
+					}
+				}
+			}
+
+			dist := math.Sqrt(float64(best))
+			if !in {
+				dist = -dist
+			}
+			dists[(y*width)+x] = dist
+		}
+	}
+	return dists
+}
@@ -0,0 +1,188 @@
+package sdf
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// generateBaseline is Generate as it was before options, it only handles
+// images at the origin
+func generateBaseline(src image.Image) image.Image {
+	srcWidth := src.Bounds().Dx()
+	srcHeight := src.Bounds().Dy()
+	grid1 := Grid{width: srcWidth, height: srcHeight, pts: make([]Point, srcWidth*srcHeight)}
+	grid2 := Grid{width: srcWidth, height: srcHeight, pts: make([]Point, srcWidth*srcHeight)}
+	for y := 0; y < srcHeight; y++ {
+		i := y * srcWidth
+		for x := 0; x < srcWidth; x++ {
+			if r, _, _, _ := src.At(x, y).RGBA(); r < 128 {
+				grid1.pts[i+x] = Point{}
+				grid2.pts[i+x] = Point{dx: 9999, dy: 9999}
+			} else {
+				grid1.pts[i+x] = Point{dx: 9999, dy: 9999}
+				grid2.pts[i+x] = Point{}
+			}
+		}
+	}
+	grid1.Generate()
+	grid2.Generate()
+
+	dest := image.NewGray(image.Rect(0, 0, srcWidth, srcHeight))
+	for y := 0; y < srcHeight; y++ {
+		i := y * srcWidth
+		for x := 0; x < srcWidth; x++ {
+			dist1 := int(math.Sqrt(float64(grid1.pts[i+x].DistSq())))
+			dist2 := int(math.Sqrt(float64(grid2.pts[i+x].DistSq())))
+			c := (dist1-dist2)*3 + 128
+			if c < 0 {
+				c = 0
+			}
+			if c > 255 {
+				c = 255
+			}
+			dest.SetGray(x, y, color.Gray{Y: uint8(c)})
+		}
+	}
+	return dest
+}
+
+func testCircle(size int, radius float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	c := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if math.Hypot(float64(x)+0.5-c, float64(y)+0.5-c) < radius {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	return img
+}
+
+func testNoise(size int) *image.RGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(256))
+	}
+	return img
+}
+
+func testImages() map[string]image.Image {
+	square := image.NewGray(image.Rect(0, 0, 48, 32))
+	for y := 8; y < 24; y++ {
+		for x := 12; x < 40; x++ {
+			square.SetGray(x, y, color.Gray{Y: 200})
+		}
+	}
+	return map[string]image.Image{
+		"circle": testCircle(64, 20),
+		"square": square,
+		"noise":  testNoise(32),
+		"empty":  image.NewGray(image.Rect(0, 0, 8, 8)),
+	}
+}
+
+func TestGenerateDefaults(t *testing.T) {
+	for name, src := range testImages() {
+		t.Run(name, func(t *testing.T) {
+			want := generateBaseline(src).(*image.Gray)
+			for _, gen := range []func(image.Image) (image.Image, error){
+				Generate,
+				func(src image.Image) (image.Image, error) { return GenerateWithOptions(src, Options{}) },
+			} {
+				got, err := gen(src)
+				if err != nil {
+					t.Fatal(err)
+				}
+				g := got.(*image.Gray)
+				if g.Rect != want.Rect {
+					t.Fatalf("field is %v, want %v", g.Rect, want.Rect)
+				}
+				for i := range want.Pix {
+					if g.Pix[i] != want.Pix[i] {
+						t.Fatalf("pixel %d is %d, want %d", i, g.Pix[i], want.Pix[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// Both algorithms agree up to a pixel of distance, 8SSEDT rounds distances
+// down to whole pixels and may miss the nearest edge by a little
+func TestBruteMatches8SSEDT(t *testing.T) {
+	const spread = 16.0
+	tolerance := 128 / spread * 1.5
+	for name, src := range testImages() {
+		t.Run(name, func(t *testing.T) {
+			fast, err := GenerateWithOptions(src, Options{Spread: spread})
+			if err != nil {
+				t.Fatal(err)
+			}
+			exact, err := GenerateWithOptions(src, Options{Spread: spread, Algorithm: AlgorithmBrute})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, e := fast.(*image.Gray), exact.(*image.Gray)
+			for i := range f.Pix {
+				if d := math.Abs(float64(f.Pix[i]) - float64(e.Pix[i])); d > tolerance {
+					t.Fatalf("pixel %d is %d with 8SSEDT and %d with brute", i, f.Pix[i], e.Pix[i])
+				}
+				// Both agree on which side of the edge a pixel is
+				if (f.Pix[i] >= 128) != (e.Pix[i] >= 128) {
+					t.Fatalf("pixel %d is %d with 8SSEDT and %d with brute", i, f.Pix[i], e.Pix[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	src := testCircle(64, 20)
+	src.Pix[0], src.Pix[3] = 0, 255
+	tests := []struct {
+		name string
+		opts Options
+		size int
+	}{
+		{"alpha", Options{Channel: ChannelAlpha}, 64},
+		{"luma", Options{Channel: ChannelLuma, Threshold: 127}, 64},
+		{"scale", Options{Scale: 3}, 22},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateWithOptions(src, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := tt.size
+			if b := got.Bounds(); b.Dx() != size || b.Dy() != size {
+				t.Fatalf("field is %v, want %dx%d", b, size, size)
+			}
+			// The centre of the circle is inside, the corners outside
+			g := got.(*image.Gray)
+			if c := g.GrayAt(size/2, size/2).Y; c <= 128 {
+				t.Fatalf("centre is %d, want inside", c)
+			}
+			if c := g.GrayAt(size-1, size-1).Y; c >= 128 {
+				t.Fatalf("corner is %d, want outside", c)
+			}
+		})
+	}
+
+	invalid := map[string]Options{
+		"spread":    {Spread: -1},
+		"scale":     {Scale: -1},
+		"channel":   {Channel: "hue"},
+		"algorithm": {Algorithm: "fast"},
+	}
+	for name, opts := range invalid {
+		if _, err := GenerateWithOptions(src, opts); err == nil {
+			t.Fatalf("invalid %s accepted", name)
+		}
+	}
+}
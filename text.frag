@@ -1,5 +1,6 @@
 #version 330 core
 in vec2 TexCoords;
+in float Colored;
 out vec4 color;
 
 uniform sampler2D text;
@@ -7,5 +8,6 @@ uniform vec3 textColor;
 
 void main() {
     vec4 sampled = texture(text, TexCoords);
-    color = vec4(textColor, 1.0) * sampled;
+    // Color glyphs keep their own colors
+    color = mix(vec4(textColor, 1.0) * sampled, sampled, Colored);
 }
@@ -1,10 +1,13 @@
 #version 330 core
 layout (location = 1) in vec4 vertex;
+layout (location = 2) in float colored;
 out vec2 TexCoords;
+out float Colored;
 
 uniform mat4 projection;
 
 void main() {
     gl_Position = projection * vec4(vertex.xy, 0.0, 1.0);
     TexCoords = vertex.zw;
+    Colored = colored;
 }
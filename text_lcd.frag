@@ -0,0 +1,17 @@
+#version 330 core
+in vec2 TexCoords;
+in float Colored;
+// Drawn with dual source blending, glBlendFunc(GL_ONE, GL_ONE_MINUS_SRC1_COLOR),
+// so every subpixel blends with its own coverage
+layout (location = 0, index = 0) out vec4 color;
+layout (location = 0, index = 1) out vec4 coverage;
+
+uniform sampler2D text;
+uniform vec3 textColor;
+
+void main() {
+    vec4 sampled = texture(text, TexCoords);
+    // Color glyphs keep their own colors and cover all subpixels alike
+    coverage = mix(sampled, vec4(sampled.a), Colored);
+    color = mix(vec4(textColor, 1.0), vec4(sampled.rgb, 1.0), Colored) * coverage;
+}